@@ -96,3 +96,46 @@ func Authenticate(ctx context.Context, config AuthConfig) error {
 		return err
 	}
 }
+
+// newClient создает клиент Telegram с файловым хранилищем сессии
+func newClient(config AuthConfig, opts telegram.Options) *telegram.Client {
+	if opts.SessionStorage == nil {
+		opts.SessionStorage = &telegram.FileSessionStorage{
+			Path: config.SessionFile,
+		}
+	}
+	return telegram.NewClient(config.AppID, config.AppHash, opts)
+}
+
+// authorize выполняет авторизацию при необходимости и проверяет ее статус
+func authorize(ctx context.Context, client *telegram.Client, config AuthConfig) error {
+	flow := auth.NewFlow(
+		auth.CodeOnly(config.Phone, &telegramCodeAuth{}),
+		auth.SendCodeOptions{},
+	)
+
+	fmt.Fprintln(os.Stderr, "Checking authorization...")
+	if err := client.Auth().IfNecessary(ctx, flow); err != nil {
+		return fmt.Errorf("authentication error: %w", err)
+	}
+
+	status, err := client.Auth().Status(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get auth status: %w", err)
+	}
+	if !status.Authorized {
+		return fmt.Errorf("not authorized")
+	}
+	return nil
+}
+
+// runAuthorized запускает клиент, авторизуется и выполняет fn в рамках сессии
+func runAuthorized(ctx context.Context, config AuthConfig, fn func(ctx context.Context, client *telegram.Client) error) error {
+	client := newClient(config, telegram.Options{})
+	return client.Run(ctx, func(ctx context.Context) error {
+		if err := authorize(ctx, client, config); err != nil {
+			return err
+		}
+		return fn(ctx, client)
+	})
+}
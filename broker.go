@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+const (
+	brokerRetryTime       = 30 * time.Second // Сколько повторять публикацию, прежде чем вернуть ошибку или отложить в outbox
+	outboxRetryInterval   = 5 * time.Second  // Как часто повторять публикацию из outbox
+	defaultSubjectNATS    = "tg.{account}.{chat_id}.{type}"
+	defaultSubjectKafka   = "tg.{account}.events"
+	defaultSubjectRedis   = "tg:{account}:events"
+	subjectPlaceholderSet = "account, chat_id, chat_type, type, user_id"
+)
+
+// BrokerOptions задает публикацию событий в брокер сообщений
+type BrokerOptions struct {
+	URL       string // nats://host:4222, host:9092[,host2:9092] для Kafka или redis://host:6379/0
+	Subject   string // Шаблон subject/topic/stream, например tg.{account}.{chat_id}.{type}
+	JetStream bool   // NATS: публиковать в JetStream и ждать подтверждения
+	MaxLen    int64  // Redis: примерный предел длины потока; 0 — без ограничения
+	OutboxDir string // Локальный outbox: события, которые не удалось опубликовать, доставляются позже
+}
+
+// brokerMessage сообщение для публикации; сохраняется в outbox как есть
+type brokerMessage struct {
+	Subject string          `json:"subject"`
+	Key     string          `json:"key"`          // Ключ партиционирования: ID чата
+	ID      string          `json:"id,omitempty"` // Идентификатор для дедупликации на стороне брокера
+	Type    EventType       `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// brokerPublisher публикует сообщение и возвращается после подтверждения брокера
+type brokerPublisher interface {
+	Publish(ctx context.Context, msg brokerMessage) error
+	Close() error
+}
+
+// subjectPlaceholder находит подстановки вида {chat_id} в шаблоне
+var subjectPlaceholder = regexp.MustCompile(`\{([a-z_]*)\}`)
+
+// subjectTemplate шаблон имени subject/topic/stream
+type subjectTemplate struct {
+	template string
+}
+
+// newSubjectTemplate проверяет, что шаблон использует только известные подстановки
+func newSubjectTemplate(template string) (*subjectTemplate, error) {
+	for _, m := range subjectPlaceholder.FindAllStringSubmatch(template, -1) {
+		switch m[1] {
+		case "account", "chat_id", "chat_type", "type", "user_id":
+		default:
+			return nil, fmt.Errorf("unknown placeholder %s in subject template: expected %s", m[0], subjectPlaceholderSet)
+		}
+	}
+	return &subjectTemplate{template: template}, nil
+}
+
+// render подставляет в шаблон значения события; пустой тип чата заменяется на none
+func (t *subjectTemplate) render(account int64, event *EventInfo) string {
+	return subjectPlaceholder.ReplaceAllStringFunc(t.template, func(m string) string {
+		switch m {
+		case "{account}":
+			return strconv.FormatInt(account, 10)
+		case "{chat_id}":
+			return strconv.FormatInt(event.ChatID, 10)
+		case "{chat_type}":
+			if event.ChatType == "" {
+				return "none"
+			}
+			return event.ChatType
+		case "{type}":
+			return string(event.Type)
+		case "{user_id}":
+			return strconv.FormatInt(event.UserID, 10)
+		}
+		return m
+	})
+}
+
+// brokerSink публикует события в брокер синхронно, дожидаясь подтверждения.
+// Порядок сообщений одного чата сохраняется: ключ партиционирования — ID чата,
+// а при непустом outbox новые события встают в очередь за отложенными
+type brokerSink struct {
+	name      string
+	sinkType  string // Метка приемника в метриках
+	publisher brokerPublisher
+	subject   *subjectTemplate
+	account   int64
+
+	outbox  *diskQueue
+	mux     sync.Mutex // Упорядочивает публикацию и запись в outbox
+	backlog bool       // В outbox есть неопубликованные сообщения
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// newBrokerSink оборачивает издателя шаблоном subject и необязательным outbox
+func newBrokerSink(name, sinkType string, publisher brokerPublisher, opts BrokerOptions, account int64) (*brokerSink, error) {
+	subject, err := newSubjectTemplate(opts.Subject)
+	if err != nil {
+		publisher.Close()
+		return nil, err
+	}
+
+	b := &brokerSink{
+		name:      name,
+		sinkType:  sinkType,
+		publisher: publisher,
+		subject:   subject,
+		account:   account,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if opts.OutboxDir == "" {
+		close(b.done)
+		return b, nil
+	}
+
+	if b.outbox, err = newDiskQueue(opts.OutboxDir); err != nil {
+		publisher.Close()
+		return nil, err
+	}
+	b.backlog = b.outbox.Len() > 0
+	go b.run()
+	return b, nil
+}
+
+func (b *brokerSink) Send(ctx context.Context, event EventInfo) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to serialize event: %w", err)
+	}
+	msg := brokerMessage{
+		Subject: b.subject.render(b.account, &event),
+		Key:     strconv.FormatInt(event.ChatID, 10),
+		ID:      eventDedupID(&event),
+		Type:    event.Type,
+		Payload: payload,
+	}
+
+	if b.outbox == nil {
+		return b.publish(ctx, msg)
+	}
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if !b.backlog {
+		err := b.publish(ctx, msg)
+		if err == nil {
+			return nil
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %s publish failed, event saved to outbox: %v\n", b.name, err)
+	}
+	data, _ := json.Marshal(msg)
+	if err := b.outbox.Push(data); err != nil {
+		return fmt.Errorf("failed to save event to outbox: %w", err)
+	}
+	b.backlog = true
+	return nil
+}
+
+func (b *brokerSink) Close(ctx context.Context) error {
+	close(b.stop)
+	<-b.done
+
+	// Последняя попытка опубликовать отложенное; остальное дождется следующего запуска
+	if b.outbox != nil {
+		b.mux.Lock()
+		b.drainOutbox(ctx)
+		b.mux.Unlock()
+	}
+	return b.publisher.Close()
+}
+
+// publish публикует сообщение с короткими повторами при временных ошибках
+func (b *brokerSink) publish(ctx context.Context, msg brokerMessage) error {
+	start := time.Now()
+	policy := backoff.NewExponentialBackOff()
+	policy.MaxElapsedTime = brokerRetryTime
+	err := backoff.Retry(func() error {
+		return b.publisher.Publish(ctx, msg)
+	}, backoff.WithContext(policy, ctx))
+	observeSinkDelivery(b.sinkType, start, err)
+	return err
+}
+
+// run периодически публикует сообщения из outbox
+func (b *brokerSink) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(outboxRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			b.mux.Lock()
+			if b.backlog {
+				ctx, cancel := context.WithTimeout(context.Background(), brokerRetryTime)
+				b.drainOutbox(ctx)
+				cancel()
+			}
+			b.mux.Unlock()
+		}
+	}
+}
+
+// drainOutbox публикует отложенные сообщения по порядку; вызывается под b.mux
+func (b *brokerSink) drainOutbox(ctx context.Context) {
+	err := b.outbox.Drain(func(data []byte) error {
+		var msg brokerMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return errQueueRejected{err}
+		}
+		start := time.Now()
+		err := b.publisher.Publish(ctx, msg)
+		observeSinkDelivery(b.sinkType, start, err)
+		return err
+	})
+	if err == nil {
+		b.backlog = false
+	}
+}
+
+// eventDedupID строит идентификатор события, одинаковый при повторной доставке после перезапуска
+func eventDedupID(event *EventInfo) string {
+	switch event.Type {
+	case EventMessage, EventChatAction:
+		if event.MessageID != 0 {
+			return fmt.Sprintf("%d:%d:%s", event.ChatID, event.MessageID, event.Type)
+		}
+	case EventEdit:
+		if event.Details != nil {
+			return fmt.Sprintf("%d:%d:edit:%d", event.ChatID, event.MessageID, event.Details.EditDate)
+		}
+	case EventDelete:
+		return fmt.Sprintf("%d:delete:%s", event.ChatID, strings.Trim(string(event.RawData), "[]"))
+	}
+	return ""
+}
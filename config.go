@@ -3,8 +3,11 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // CommandType представляет тип команды
@@ -23,6 +26,34 @@ const (
 	CommandMessages CommandType = "messages"
 	// CommandEvents команда отслеживания событий Telegram
 	CommandEvents CommandType = "events"
+	// CommandSearch команда поиска сообщений
+	CommandSearch CommandType = "search"
+	// CommandSend команда отправки сообщения
+	CommandSend CommandType = "send"
+	// CommandEdit команда редактирования сообщения
+	CommandEdit CommandType = "edit"
+	// CommandDelete команда удаления сообщений
+	CommandDelete CommandType = "delete"
+	// CommandPin команда закрепления сообщения
+	CommandPin CommandType = "pin"
+	// CommandUnpin команда открепления сообщения
+	CommandUnpin CommandType = "unpin"
+	// CommandForward команда пересылки сообщений
+	CommandForward CommandType = "forward"
+	// CommandDownload команда скачивания медиа
+	CommandDownload CommandType = "download"
+	// CommandReplies команда получения ответов в ветке обсуждения
+	CommandReplies CommandType = "replies"
+	// CommandTopics команда получения списка тем форума
+	CommandTopics CommandType = "topics"
+	// CommandRead команда отметки сообщений прочитанными
+	CommandRead CommandType = "read"
+	// CommandTyping команда установки статуса набора
+	CommandTyping CommandType = "typing"
+	// CommandStatus команда смены статуса присутствия
+	CommandStatus CommandType = "status"
+	// CommandDaemon команда для отслеживания событий под наблюдением с переподключением
+	CommandDaemon CommandType = "daemon"
 	// CommandUnknown неизвестная команда
 	CommandUnknown CommandType = "unknown"
 )
@@ -31,9 +62,70 @@ const (
 type Config struct {
 	Command    CommandType
 	AuthConfig AuthConfig
-	ChatID     int64 // ID чата для команды messages
-	Limit      int   // Ограничение на количество сообщений
-	Timeout    int   // Таймаут в секундах для команды events
+	ChatID     int64           // ID чата для команды messages
+	History    HistoryOptions  // Параметры выборки истории для команды messages
+	Events     EventsOptions   // Параметры команд events и daemon
+	Daemon     DaemonOptions   // Параметры наблюдения для команды daemon
+	Search     SearchOptions   // Параметры команды search
+	Send       SendOptions     // Параметры команды send
+	Edit       EditOptions     // Параметры команды edit
+	Delete     DeleteOptions   // Параметры команды delete
+	Pin        PinOptions      // Параметры команд pin и unpin
+	Forward    ForwardOptions  // Параметры команды forward
+	Download   DownloadOptions // Параметры скачивания медиа для команд download и messages
+	Replies    RepliesOptions  // Параметры команды replies
+	Topics     TopicsOptions   // Параметры команды topics
+	Read       ReadOptions     // Параметры команды read
+	Typing     TypingOptions   // Параметры команды typing
+	Status     string          // Статус присутствия для команды status: online или offline
+}
+
+// authFlags содержит общие для всех команд флаги авторизации
+type authFlags struct {
+	appID       *int
+	appHash     *string
+	phone       *string
+	sessionFile *string
+	help        *bool
+}
+
+// newAuthFlags регистрирует общие флаги авторизации в наборе флагов команды
+func newAuthFlags(fs *flag.FlagSet) authFlags {
+	return authFlags{
+		appID:       fs.Int("app-id", 0, "Telegram app ID"),
+		appHash:     fs.String("app-hash", "", "Telegram app hash"),
+		phone:       fs.String("phone", "", "Phone number in international format"),
+		sessionFile: fs.String("session-file", "tg-session.json", "Path to session file"),
+		help:        fs.Bool("help", false, "Show help for command"),
+	}
+}
+
+// authConfig дополняет флаги переменными окружения и проверяет обязательные параметры
+func (f authFlags) authConfig() (AuthConfig, error) {
+	if *f.appID == 0 {
+		if envID := os.Getenv("APP_ID"); envID != "" {
+			fmt.Sscanf(envID, "%d", f.appID)
+		}
+	}
+
+	if *f.appHash == "" {
+		*f.appHash = os.Getenv("APP_HASH")
+	}
+
+	if *f.phone == "" {
+		*f.phone = os.Getenv("PHONE")
+	}
+
+	if *f.appID == 0 || *f.appHash == "" || *f.phone == "" {
+		return AuthConfig{}, fmt.Errorf("required parameters missing: provide app-id, app-hash, and phone via flags or environment variables")
+	}
+
+	return AuthConfig{
+		AppID:       *f.appID,
+		AppHash:     *f.appHash,
+		Phone:       *f.phone,
+		SessionFile: *f.sessionFile,
+	}, nil
 }
 
 // ParseConfig парсит команды и параметры командной строки
@@ -128,6 +220,17 @@ func ParseConfig() (Config, error) {
 		sessionFile := messagesFlags.String("session-file", "tg-session.json", "Path to session file")
 		chatID := messagesFlags.Int64("chat-id", 0, "Chat ID to get messages from")
 		limit := messagesFlags.Int("limit", 20, "Maximum number of messages to retrieve")
+		offsetID := messagesFlags.Int("offset-id", 0, "Start from messages older than this message ID")
+		minID := messagesFlags.Int("min-id", 0, "Only return messages with ID greater than this")
+		maxID := messagesFlags.Int("max-id", 0, "Only return messages with ID less than this")
+		since := messagesFlags.String("since", "", "Only return messages after this time (RFC3339, YYYY-MM-DD or relative like 7d, 12h)")
+		until := messagesFlags.String("until", "", "Only return messages before this time (RFC3339, YYYY-MM-DD or relative like 7d, 12h)")
+		all := messagesFlags.Bool("all", false, "Walk the whole history and stream messages as NDJSON (ignores --limit)")
+		downloadMedia := messagesFlags.String("download-media", "", "Download media of every message into this directory")
+		downloadThreads := messagesFlags.Int("download-threads", 4, "Number of file parts downloaded in parallel")
+		nameTemplate := messagesFlags.String("name-template", defaultNameTemplate, "Downloaded file name template: {chat_id}, {msg_id}, {date}, {type}, {name}, {ext}")
+		render := messagesFlags.String("render", "", "Add formatted text to every message: markdown, html or plain")
+		topic := messagesFlags.Int("topic", 0, "Only return messages of this forum topic")
 		help := messagesFlags.Bool("help", false, "Show help for command")
 
 		// Парсим аргументы после команды
@@ -179,6 +282,19 @@ func ParseConfig() (Config, error) {
 			return Config{Command: command}, fmt.Errorf("chat-id is required")
 		}
 
+		// Разбираем границы по дате
+		sinceTime, err := parseTimeBound(*since)
+		if err != nil {
+			return Config{Command: command}, fmt.Errorf("invalid --since: %w", err)
+		}
+		untilTime, err := parseTimeBound(*until)
+		if err != nil {
+			return Config{Command: command}, fmt.Errorf("invalid --until: %w", err)
+		}
+		if _, err := renderText("", nil, *render); err != nil {
+			return Config{Command: command}, err
+		}
+
 		// Создаем и возвращаем конфигурацию
 		return Config{
 			Command: command,
@@ -189,64 +305,671 @@ func ParseConfig() (Config, error) {
 				SessionFile: *sessionFile,
 			},
 			ChatID: *chatID,
-			Limit:  *limit,
+			History: HistoryOptions{
+				Limit:    *limit,
+				OffsetID: *offsetID,
+				MinID:    *minID,
+				MaxID:    *maxID,
+				Since:    sinceTime,
+				Until:    untilTime,
+				All:      *all,
+				Render:   *render,
+				TopicID:  *topic,
+			},
+			Download: DownloadOptions{
+				Dir:          *downloadMedia,
+				Threads:      *downloadThreads,
+				NameTemplate: *nameTemplate,
+			},
 		}, nil
 	}
 
-	// Если это команда events
-	if command == CommandEvents {
-		// Создаем новый набор флагов для аргументов
-		eventsFlags := flag.NewFlagSet(string(command), flag.ExitOnError)
-		appID := eventsFlags.Int("app-id", 0, "Telegram app ID")
-		appHash := eventsFlags.String("app-hash", "", "Telegram app hash")
-		phone := eventsFlags.String("phone", "", "Phone number in international format")
-		sessionFile := eventsFlags.String("session-file", "tg-session.json", "Path to session file")
-		timeout := eventsFlags.Int("timeout", 0, "Timeout in seconds (0 = infinite)")
-		help := eventsFlags.Bool("help", false, "Show help for command")
+	// Если это команда events или daemon
+	if command == CommandEvents || command == CommandDaemon {
+		return parseEventsConfig(command, os.Args[2:], false)
+	}
+
+	// Если это команда search
+	if command == CommandSearch {
+		searchFlags := flag.NewFlagSet(string(command), flag.ExitOnError)
+		authArgs := newAuthFlags(searchFlags)
+		query := searchFlags.String("query", "", "Text to search for")
+		chat := searchFlags.String("chat", "", "Chat to search in: chat ID or @username (empty = all chats)")
+		from := searchFlags.String("from", "", "Only messages from this sender: user ID or @username (requires --chat)")
+		filter := searchFlags.String("filter", "", "Message filter: photo, video, document, url, voice, pinned, mentions")
+		limit := searchFlags.Int("limit", 20, "Maximum number of messages to retrieve")
+		offsetID := searchFlags.Int("offset-id", 0, "Start from messages older than this message ID")
+		since := searchFlags.String("since", "", "Only return messages after this time (RFC3339, YYYY-MM-DD or relative like 7d, 12h)")
+		until := searchFlags.String("until", "", "Only return messages before this time (RFC3339, YYYY-MM-DD or relative like 7d, 12h)")
+		all := searchFlags.Bool("all", false, "Fetch all results and stream them as NDJSON (ignores --limit)")
+		render := searchFlags.String("render", "", "Add formatted text to every message: markdown, html or plain")
 
 		// Парсим аргументы после команды
-		err := eventsFlags.Parse(os.Args[2:])
+		if err := searchFlags.Parse(os.Args[2:]); err != nil {
+			return Config{Command: command}, err
+		}
+
+		// Если запрошена справка
+		if *authArgs.help {
+			printSearchHelp(searchFlags)
+			os.Exit(0)
+		}
+
+		authConfig, err := authArgs.authConfig()
+		if err != nil {
+			printSearchHelp(searchFlags)
+			return Config{Command: command}, err
+		}
+
+		// Проверяем параметры поиска
+		if *query == "" && *filter == "" && *from == "" {
+			printSearchHelp(searchFlags)
+			return Config{Command: command}, fmt.Errorf("query, filter or from is required")
+		}
+		if _, err := searchFilter(*filter); err != nil {
+			return Config{Command: command}, err
+		}
+		if *from != "" && *chat == "" {
+			return Config{Command: command}, fmt.Errorf("--from requires --chat")
+		}
+
+		// Разбираем границы по дате
+		sinceTime, err := parseTimeBound(*since)
 		if err != nil {
+			return Config{Command: command}, fmt.Errorf("invalid --since: %w", err)
+		}
+		untilTime, err := parseTimeBound(*until)
+		if err != nil {
+			return Config{Command: command}, fmt.Errorf("invalid --until: %w", err)
+		}
+		if _, err := renderText("", nil, *render); err != nil {
+			return Config{Command: command}, err
+		}
+
+		return Config{
+			Command:    command,
+			AuthConfig: authConfig,
+			Search: SearchOptions{
+				Query:  *query,
+				Chat:   *chat,
+				From:   *from,
+				Filter: *filter,
+				History: HistoryOptions{
+					Limit:    *limit,
+					OffsetID: *offsetID,
+					Since:    sinceTime,
+					Until:    untilTime,
+					All:      *all,
+					Render:   *render,
+				},
+			},
+		}, nil
+	}
+
+	// Если это команда send
+	if command == CommandSend {
+		sendFlags := flag.NewFlagSet(string(command), flag.ExitOnError)
+		authArgs := newAuthFlags(sendFlags)
+		chat := sendFlags.String("chat", "", "Chat to send to: chat ID or @username")
+		text := sendFlags.String("text", "", "Message text (\"-\" = read from stdin; empty = read from stdin when it is not a terminal)")
+		parseMode := sendFlags.String("parse-mode", "", "Text formatting: markdown or html")
+		replyTo := sendFlags.Int("reply-to", 0, "ID of the message to reply to")
+		silent := sendFlags.Bool("silent", false, "Send without notification")
+		noWebpage := sendFlags.Bool("no-webpage", false, "Disable link previews")
+		schedule := sendFlags.String("schedule", "", "Schedule the message (RFC3339, YYYY-MM-DD or delay like 30m, 2h, 1d)")
+		topic := sendFlags.Int("topic", 0, "Forum topic ID to send the message to")
+		var files stringList
+		sendFlags.Var(&files, "file", "File to send (repeatable, up to 10 as an album; \"-\" = read from stdin)")
+		as := sendFlags.String("as", "", "Send files as: photo, video, document, voice, audio (default: by MIME type)")
+		caption := sendFlags.String("caption", "", "Caption for the files (defaults to --text)")
+		fileName := sendFlags.String("file-name", "file", "File name for data read from stdin")
+
+		// Парсим аргументы после команды
+		if err := sendFlags.Parse(os.Args[2:]); err != nil {
 			return Config{Command: command}, err
 		}
 
 		// Если запрошена справка
-		if *help {
-			printEventsHelp(eventsFlags)
+		if *authArgs.help {
+			printSendHelp(sendFlags)
 			os.Exit(0)
 		}
 
-		// Проверяем переменные окружения
-		if *appID == 0 {
-			if envID := os.Getenv("APP_ID"); envID != "" {
-				fmt.Sscanf(envID, "%d", appID)
+		authConfig, err := authArgs.authConfig()
+		if err != nil {
+			printSendHelp(sendFlags)
+			return Config{Command: command}, err
+		}
+
+		if *chat == "" {
+			printSendHelp(sendFlags)
+			return Config{Command: command}, fmt.Errorf("chat is required")
+		}
+		if *parseMode != ParseModeNone && *parseMode != ParseModeMarkdown && *parseMode != ParseModeHTML {
+			return Config{Command: command}, fmt.Errorf("invalid --parse-mode %q: expected markdown or html", *parseMode)
+		}
+		if len(files) > maxAlbumFiles {
+			return Config{Command: command}, fmt.Errorf("at most %d files can be sent at once", maxAlbumFiles)
+		}
+		switch *as {
+		case "", UploadAsPhoto, UploadAsVideo, UploadAsDocument, UploadAsVoice, UploadAsAudio:
+		default:
+			return Config{Command: command}, fmt.Errorf("invalid --as %q: expected photo, video, document, voice or audio", *as)
+		}
+		stdinFiles := 0
+		for _, f := range files {
+			if f == "-" {
+				stdinFiles++
 			}
 		}
+		if stdinFiles > 1 || (stdinFiles == 1 && *text == "-") {
+			return Config{Command: command}, fmt.Errorf("stdin can be used only once")
+		}
 
-		if *appHash == "" {
-			*appHash = os.Getenv("APP_HASH")
+		scheduleTime, err := parseScheduleTime(*schedule)
+		if err != nil {
+			return Config{Command: command}, fmt.Errorf("invalid --schedule: %w", err)
 		}
 
-		if *phone == "" {
-			*phone = os.Getenv("PHONE")
+		return Config{
+			Command:    command,
+			AuthConfig: authConfig,
+			Send: SendOptions{
+				Chat:      *chat,
+				Text:      *text,
+				ParseMode: *parseMode,
+				ReplyTo:   *replyTo,
+				Silent:    *silent,
+				NoWebpage: *noWebpage,
+				Schedule:  scheduleTime,
+				TopicID:   *topic,
+				Files:     files,
+				As:        *as,
+				Caption:   *caption,
+				FileName:  *fileName,
+			},
+		}, nil
+	}
+
+	// Если это команда edit
+	if command == CommandEdit {
+		editFlags := flag.NewFlagSet(string(command), flag.ExitOnError)
+		authArgs := newAuthFlags(editFlags)
+		chat := editFlags.String("chat", "", "Chat with the message: chat ID or @username")
+		id := editFlags.Int("id", 0, "ID of the message to edit")
+		text := editFlags.String("text", "", "New message text (\"-\" = read from stdin; empty = read from stdin when it is not a terminal)")
+		parseMode := editFlags.String("parse-mode", "", "Text formatting: markdown or html")
+		noWebpage := editFlags.Bool("no-webpage", false, "Disable link previews")
+
+		// Парсим аргументы после команды
+		if err := editFlags.Parse(os.Args[2:]); err != nil {
+			return Config{Command: command}, err
 		}
 
-		// Проверяем, что все необходимые параметры заданы
-		if *appID == 0 || *appHash == "" || *phone == "" {
-			printEventsHelp(eventsFlags)
-			return Config{Command: command}, fmt.Errorf("required parameters missing: provide app-id, app-hash, and phone via flags or environment variables")
+		// Если запрошена справка
+		if *authArgs.help {
+			printMessageActionHelp(command, "Edit the text of a message and print it in JSON format.", editFlags)
+			os.Exit(0)
+		}
+
+		authConfig, err := authArgs.authConfig()
+		if err != nil {
+			printMessageActionHelp(command, "Edit the text of a message and print it in JSON format.", editFlags)
+			return Config{Command: command}, err
+		}
+
+		if *chat == "" || *id == 0 {
+			printMessageActionHelp(command, "Edit the text of a message and print it in JSON format.", editFlags)
+			return Config{Command: command}, fmt.Errorf("chat and id are required")
+		}
+		if *parseMode != ParseModeNone && *parseMode != ParseModeMarkdown && *parseMode != ParseModeHTML {
+			return Config{Command: command}, fmt.Errorf("invalid --parse-mode %q: expected markdown or html", *parseMode)
 		}
 
-		// Создаем и возвращаем конфигурацию
 		return Config{
-			Command: command,
-			AuthConfig: AuthConfig{
-				AppID:       *appID,
-				AppHash:     *appHash,
-				Phone:       *phone,
-				SessionFile: *sessionFile,
+			Command:    command,
+			AuthConfig: authConfig,
+			Edit: EditOptions{
+				Chat:      *chat,
+				ID:        *id,
+				Text:      *text,
+				ParseMode: *parseMode,
+				NoWebpage: *noWebpage,
+			},
+		}, nil
+	}
+
+	// Если это команда delete
+	if command == CommandDelete {
+		deleteFlags := flag.NewFlagSet(string(command), flag.ExitOnError)
+		authArgs := newAuthFlags(deleteFlags)
+		chat := deleteFlags.String("chat", "", "Chat with the messages: chat ID or @username")
+		ids := deleteFlags.String("ids", "", "Comma-separated message IDs to delete")
+		revoke := deleteFlags.Bool("revoke", false, "Delete messages for everyone in private chats and basic groups (channels and supergroups always delete for everyone)")
+
+		// Парсим аргументы после команды
+		if err := deleteFlags.Parse(os.Args[2:]); err != nil {
+			return Config{Command: command}, err
+		}
+
+		// Если запрошена справка
+		if *authArgs.help {
+			printMessageActionHelp(command, "Delete messages and print the result in JSON format.", deleteFlags)
+			os.Exit(0)
+		}
+
+		authConfig, err := authArgs.authConfig()
+		if err != nil {
+			printMessageActionHelp(command, "Delete messages and print the result in JSON format.", deleteFlags)
+			return Config{Command: command}, err
+		}
+
+		messageIDs, err := parseIDList(*ids)
+		if err != nil {
+			return Config{Command: command}, fmt.Errorf("invalid --ids: %w", err)
+		}
+		if *chat == "" || len(messageIDs) == 0 {
+			printMessageActionHelp(command, "Delete messages and print the result in JSON format.", deleteFlags)
+			return Config{Command: command}, fmt.Errorf("chat and ids are required")
+		}
+
+		return Config{
+			Command:    command,
+			AuthConfig: authConfig,
+			Delete: DeleteOptions{
+				Chat:   *chat,
+				IDs:    messageIDs,
+				Revoke: *revoke,
+			},
+		}, nil
+	}
+
+	// Если это команда pin или unpin
+	if command == CommandPin || command == CommandUnpin {
+		description := "Pin a message and print the result in JSON format."
+		if command == CommandUnpin {
+			description = "Unpin a message and print the result in JSON format."
+		}
+
+		pinFlags := flag.NewFlagSet(string(command), flag.ExitOnError)
+		authArgs := newAuthFlags(pinFlags)
+		chat := pinFlags.String("chat", "", "Chat with the message: chat ID or @username")
+		id := pinFlags.Int("id", 0, "ID of the message")
+		silent := pinFlags.Bool("silent", false, "Do not notify chat members")
+
+		// Парсим аргументы после команды
+		if err := pinFlags.Parse(os.Args[2:]); err != nil {
+			return Config{Command: command}, err
+		}
+
+		// Если запрошена справка
+		if *authArgs.help {
+			printMessageActionHelp(command, description, pinFlags)
+			os.Exit(0)
+		}
+
+		authConfig, err := authArgs.authConfig()
+		if err != nil {
+			printMessageActionHelp(command, description, pinFlags)
+			return Config{Command: command}, err
+		}
+
+		if *chat == "" || *id == 0 {
+			printMessageActionHelp(command, description, pinFlags)
+			return Config{Command: command}, fmt.Errorf("chat and id are required")
+		}
+
+		return Config{
+			Command:    command,
+			AuthConfig: authConfig,
+			Pin: PinOptions{
+				Chat:   *chat,
+				ID:     *id,
+				Unpin:  command == CommandUnpin,
+				Silent: *silent,
+			},
+		}, nil
+	}
+
+	// Если это команда forward
+	if command == CommandForward {
+		forwardFlags := flag.NewFlagSet(string(command), flag.ExitOnError)
+		authArgs := newAuthFlags(forwardFlags)
+		fromChat := forwardFlags.String("from-chat", "", "Source chat: chat ID or @username")
+		toChat := forwardFlags.String("to-chat", "", "Destination chat: chat ID or @username")
+		ids := forwardFlags.String("ids", "", "Comma-separated message IDs to forward")
+		dropAuthor := forwardFlags.Bool("drop-author", false, "Forward as a copy without the original author")
+		silent := forwardFlags.Bool("silent", false, "Send without notification")
+		topic := forwardFlags.Int("topic", 0, "Forum topic ID in the destination chat")
+
+		// Парсим аргументы после команды
+		if err := forwardFlags.Parse(os.Args[2:]); err != nil {
+			return Config{Command: command}, err
+		}
+
+		// Если запрошена справка
+		if *authArgs.help {
+			printMessageActionHelp(command, "Forward messages to another chat and print the copies in JSON format.", forwardFlags)
+			os.Exit(0)
+		}
+
+		authConfig, err := authArgs.authConfig()
+		if err != nil {
+			printMessageActionHelp(command, "Forward messages to another chat and print the copies in JSON format.", forwardFlags)
+			return Config{Command: command}, err
+		}
+
+		messageIDs, err := parseIDList(*ids)
+		if err != nil {
+			return Config{Command: command}, fmt.Errorf("invalid --ids: %w", err)
+		}
+		if *fromChat == "" || *toChat == "" || len(messageIDs) == 0 {
+			printMessageActionHelp(command, "Forward messages to another chat and print the copies in JSON format.", forwardFlags)
+			return Config{Command: command}, fmt.Errorf("from-chat, to-chat and ids are required")
+		}
+
+		return Config{
+			Command:    command,
+			AuthConfig: authConfig,
+			Forward: ForwardOptions{
+				FromChat:   *fromChat,
+				ToChat:     *toChat,
+				IDs:        messageIDs,
+				DropAuthor: *dropAuthor,
+				Silent:     *silent,
+				TopicID:    *topic,
+			},
+		}, nil
+	}
+
+	// Если это команда download
+	if command == CommandDownload {
+		downloadFlags := flag.NewFlagSet(string(command), flag.ExitOnError)
+		authArgs := newAuthFlags(downloadFlags)
+		chat := downloadFlags.String("chat", "", "Chat with the message: chat ID or @username")
+		id := downloadFlags.Int("id", 0, "ID of the message with media")
+		dir := downloadFlags.String("dir", ".", "Directory to save the file to")
+		threads := downloadFlags.Int("threads", 4, "Number of file parts downloaded in parallel")
+		nameTemplate := downloadFlags.String("name-template", defaultNameTemplate, "File name template: {chat_id}, {msg_id}, {date}, {type}, {name}, {ext}")
+
+		// Парсим аргументы после команды
+		if err := downloadFlags.Parse(os.Args[2:]); err != nil {
+			return Config{Command: command}, err
+		}
+
+		// Если запрошена справка
+		if *authArgs.help {
+			printMessageActionHelp(command, "Download media of a message and print the message with the local path in JSON format.\nFiles are always fetched from the DC that stores them: CDN redirects are not supported.", downloadFlags)
+			os.Exit(0)
+		}
+
+		authConfig, err := authArgs.authConfig()
+		if err != nil {
+			printMessageActionHelp(command, "Download media of a message and print the message with the local path in JSON format.\nFiles are always fetched from the DC that stores them: CDN redirects are not supported.", downloadFlags)
+			return Config{Command: command}, err
+		}
+
+		if *chat == "" || *id == 0 {
+			printMessageActionHelp(command, "Download media of a message and print the message with the local path in JSON format.\nFiles are always fetched from the DC that stores them: CDN redirects are not supported.", downloadFlags)
+			return Config{Command: command}, fmt.Errorf("chat and id are required")
+		}
+
+		return Config{
+			Command:    command,
+			AuthConfig: authConfig,
+			Download: DownloadOptions{
+				Chat:         *chat,
+				ID:           *id,
+				Dir:          *dir,
+				Threads:      *threads,
+				NameTemplate: *nameTemplate,
+			},
+		}, nil
+	}
+
+	// Если это команда replies
+	if command == CommandReplies {
+		repliesFlags := flag.NewFlagSet(string(command), flag.ExitOnError)
+		authArgs := newAuthFlags(repliesFlags)
+		chat := repliesFlags.String("chat", "", "Chat or channel with the message: chat ID or @username")
+		msgID := repliesFlags.Int("msg-id", 0, "ID of the message or channel post to get replies to")
+		limit := repliesFlags.Int("limit", 20, "Maximum number of replies to retrieve")
+		offsetID := repliesFlags.Int("offset-id", 0, "Start from replies older than this message ID")
+		minID := repliesFlags.Int("min-id", 0, "Only return replies with ID greater than this")
+		maxID := repliesFlags.Int("max-id", 0, "Only return replies with ID less than this")
+		since := repliesFlags.String("since", "", "Only return replies after this time (RFC3339, YYYY-MM-DD or relative like 7d, 12h)")
+		until := repliesFlags.String("until", "", "Only return replies before this time (RFC3339, YYYY-MM-DD or relative like 7d, 12h)")
+		all := repliesFlags.Bool("all", false, "Walk the whole thread and stream replies as NDJSON (ignores --limit)")
+		render := repliesFlags.String("render", "", "Add formatted text to every message: markdown, html or plain")
+
+		// Парсим аргументы после команды
+		if err := repliesFlags.Parse(os.Args[2:]); err != nil {
+			return Config{Command: command}, err
+		}
+
+		// Если запрошена справка
+		if *authArgs.help {
+			printRepliesHelp(repliesFlags)
+			os.Exit(0)
+		}
+
+		authConfig, err := authArgs.authConfig()
+		if err != nil {
+			printRepliesHelp(repliesFlags)
+			return Config{Command: command}, err
+		}
+
+		if *chat == "" || *msgID == 0 {
+			printRepliesHelp(repliesFlags)
+			return Config{Command: command}, fmt.Errorf("chat and msg-id are required")
+		}
+
+		// Разбираем границы по дате
+		sinceTime, err := parseTimeBound(*since)
+		if err != nil {
+			return Config{Command: command}, fmt.Errorf("invalid --since: %w", err)
+		}
+		untilTime, err := parseTimeBound(*until)
+		if err != nil {
+			return Config{Command: command}, fmt.Errorf("invalid --until: %w", err)
+		}
+		if _, err := renderText("", nil, *render); err != nil {
+			return Config{Command: command}, err
+		}
+
+		return Config{
+			Command:    command,
+			AuthConfig: authConfig,
+			Replies: RepliesOptions{
+				Chat:  *chat,
+				MsgID: *msgID,
+				History: HistoryOptions{
+					Limit:    *limit,
+					OffsetID: *offsetID,
+					MinID:    *minID,
+					MaxID:    *maxID,
+					Since:    sinceTime,
+					Until:    untilTime,
+					All:      *all,
+					Render:   *render,
+				},
 			},
-			Timeout: *timeout,
+		}, nil
+	}
+
+	// Если это команда topics
+	if command == CommandTopics {
+		topicsFlags := flag.NewFlagSet(string(command), flag.ExitOnError)
+		authArgs := newAuthFlags(topicsFlags)
+		chat := topicsFlags.String("chat", "", "Supergroup with forum topics: chat ID or @username")
+		query := topicsFlags.String("query", "", "Only topics whose title matches this text")
+		limit := topicsFlags.Int("limit", 100, "Maximum number of topics to retrieve")
+
+		// Парсим аргументы после команды
+		if err := topicsFlags.Parse(os.Args[2:]); err != nil {
+			return Config{Command: command}, err
+		}
+
+		// Если запрошена справка
+		if *authArgs.help {
+			printMessageActionHelp(command, "List forum topics of a supergroup in JSON format.", topicsFlags)
+			os.Exit(0)
+		}
+
+		authConfig, err := authArgs.authConfig()
+		if err != nil {
+			printMessageActionHelp(command, "List forum topics of a supergroup in JSON format.", topicsFlags)
+			return Config{Command: command}, err
+		}
+
+		if *chat == "" {
+			printMessageActionHelp(command, "List forum topics of a supergroup in JSON format.", topicsFlags)
+			return Config{Command: command}, fmt.Errorf("chat is required")
+		}
+
+		return Config{
+			Command:    command,
+			AuthConfig: authConfig,
+			Topics: TopicsOptions{
+				Chat:  *chat,
+				Query: *query,
+				Limit: *limit,
+			},
+		}, nil
+	}
+
+	// Если это команда read
+	if command == CommandRead {
+		readFlags := flag.NewFlagSet(string(command), flag.ExitOnError)
+		authArgs := newAuthFlags(readFlags)
+		chat := readFlags.String("chat", "", "Chat to mark as read: chat ID or @username")
+		maxID := readFlags.Int("max-id", 0, "Mark messages up to this ID as read (0 = all)")
+		topic := readFlags.Int("topic", 0, "Forum topic to mark as read")
+		mentions := readFlags.Bool("mentions", false, "Also mark mentions as read")
+		reactions := readFlags.Bool("reactions", false, "Also mark reactions as read")
+
+		// Парсим аргументы после команды
+		if err := readFlags.Parse(os.Args[2:]); err != nil {
+			return Config{Command: command}, err
+		}
+
+		// Если запрошена справка
+		if *authArgs.help {
+			printMessageActionHelp(command, "Mark messages in a chat as read and print the result in JSON format.", readFlags)
+			os.Exit(0)
+		}
+
+		authConfig, err := authArgs.authConfig()
+		if err != nil {
+			printMessageActionHelp(command, "Mark messages in a chat as read and print the result in JSON format.", readFlags)
+			return Config{Command: command}, err
+		}
+
+		if *chat == "" {
+			printMessageActionHelp(command, "Mark messages in a chat as read and print the result in JSON format.", readFlags)
+			return Config{Command: command}, fmt.Errorf("chat is required")
+		}
+
+		return Config{
+			Command:    command,
+			AuthConfig: authConfig,
+			Read: ReadOptions{
+				Chat:      *chat,
+				MaxID:     *maxID,
+				TopicID:   *topic,
+				Mentions:  *mentions,
+				Reactions: *reactions,
+			},
+		}, nil
+	}
+
+	// Если это команда typing
+	if command == CommandTyping {
+		typingFlags := flag.NewFlagSet(string(command), flag.ExitOnError)
+		authArgs := newAuthFlags(typingFlags)
+		chat := typingFlags.String("chat", "", "Chat to show the status in: chat ID or @username")
+		action := typingFlags.String("action", "typing", "Action: typing, upload_photo, record_video, upload_video, record_voice, upload_voice, upload_document, choose_sticker, find_location, choose_contact, record_video_note, upload_video_note or cancel")
+		topic := typingFlags.Int("topic", 0, "Forum topic to show the status in")
+		duration := typingFlags.Duration("duration", 0, "Keep the status for this long, e.g. 10s (0 = send once, Telegram shows it for about 5 seconds)")
+
+		// Парсим аргументы после команды
+		if err := typingFlags.Parse(os.Args[2:]); err != nil {
+			return Config{Command: command}, err
+		}
+
+		// Если запрошена справка
+		if *authArgs.help {
+			printMessageActionHelp(command, "Show a typing or upload status in a chat.", typingFlags)
+			os.Exit(0)
+		}
+
+		authConfig, err := authArgs.authConfig()
+		if err != nil {
+			printMessageActionHelp(command, "Show a typing or upload status in a chat.", typingFlags)
+			return Config{Command: command}, err
+		}
+
+		if *chat == "" {
+			printMessageActionHelp(command, "Show a typing or upload status in a chat.", typingFlags)
+			return Config{Command: command}, fmt.Errorf("chat is required")
+		}
+		if _, err := typingAction(*action); err != nil {
+			return Config{Command: command}, err
+		}
+
+		return Config{
+			Command:    command,
+			AuthConfig: authConfig,
+			Typing: TypingOptions{
+				Chat:     *chat,
+				Action:   *action,
+				TopicID:  *topic,
+				Duration: *duration,
+			},
+		}, nil
+	}
+
+	// Если это команда status
+	if command == CommandStatus {
+		statusFlags := flag.NewFlagSet(string(command), flag.ExitOnError)
+		authArgs := newAuthFlags(statusFlags)
+
+		// Статус передается первым аргументом: status online [options]
+		args := os.Args[2:]
+		status := ""
+		if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+			status, args = args[0], args[1:]
+		}
+
+		// Парсим аргументы после статуса
+		if err := statusFlags.Parse(args); err != nil {
+			return Config{Command: command}, err
+		}
+		if status == "" && statusFlags.NArg() > 0 {
+			status = statusFlags.Arg(0)
+		}
+
+		// Если запрошена справка
+		if *authArgs.help {
+			printMessageActionHelp(command, "Set account presence: telegram-auth status online|offline [options]", statusFlags)
+			os.Exit(0)
+		}
+
+		authConfig, err := authArgs.authConfig()
+		if err != nil {
+			printMessageActionHelp(command, "Set account presence: telegram-auth status online|offline [options]", statusFlags)
+			return Config{Command: command}, err
+		}
+
+		if status != StatusOnline && status != StatusOffline {
+			printMessageActionHelp(command, "Set account presence: telegram-auth status online|offline [options]", statusFlags)
+			return Config{Command: command}, fmt.Errorf("status must be online or offline")
+		}
+
+		return Config{
+			Command:    command,
+			AuthConfig: authConfig,
+			Status:     status,
 		}, nil
 	}
 
@@ -254,6 +977,211 @@ func ParseConfig() (Config, error) {
 	return Config{Command: CommandUnknown}, fmt.Errorf("unknown command: %s", command)
 }
 
+// parseEventsConfig разбирает флаги команд events и daemon. С reload ошибки
+// возвращаются вместо завершения процесса: так демон перечитывает конфигурацию по SIGHUP
+func parseEventsConfig(command CommandType, args []string, reload bool) (Config, error) {
+	// При перезагрузке ошибки не должны завершать процесс, а справка — попадать в поток событий
+	errorHandling, printHelp := flag.ExitOnError, printEventsHelp
+	if command == CommandDaemon {
+		printHelp = printDaemonHelp
+	}
+	if reload {
+		errorHandling, printHelp = flag.ContinueOnError, func(*flag.FlagSet) {}
+	}
+
+	// Создаем новый набор флагов для аргументов
+	eventsFlags := flag.NewFlagSet(string(command), errorHandling)
+	if reload {
+		eventsFlags.SetOutput(io.Discard)
+		eventsFlags.Usage = func() {}
+	}
+	authArgs := newAuthFlags(eventsFlags)
+	timeout := new(int)
+	var daemon DaemonOptions
+	if command == CommandDaemon {
+		eventsFlags.StringVar(&daemon.ConfigFile, "config", "", "File with flags as 'name = value' lines, re-read on SIGHUP")
+		eventsFlags.DurationVar(&daemon.MaxBackoff, "max-backoff", 5*time.Minute, "Maximum delay between reconnect attempts")
+		eventsFlags.StringVar(&daemon.AlertURL, "alert-url", "", "URL to POST a JSON alert to when the session is revoked")
+	} else {
+		timeout = eventsFlags.Int("timeout", 0, "Timeout in seconds (0 = infinite)")
+	}
+	stateFile := eventsFlags.String("state-file", "tg-updates.json", "Path to update state file used to resume after restart")
+	fresh := eventsFlags.Bool("fresh", false, "Ignore saved update state and start from current events")
+	metricsAddr := eventsFlags.String("metrics-addr", "", "Serve Prometheus metrics on this address, e.g. :9090")
+	chats := eventsFlags.String("chats", "", "Only events from these chats: comma-separated IDs or @usernames")
+	excludeChats := eventsFlags.String("exclude-chats", "", "Skip events from these chats: comma-separated IDs or @usernames")
+	types := eventsFlags.String("types", "", "Only these event types, e.g. message,edit,delete")
+	from := eventsFlags.String("from", "", "Only events from these senders: comma-separated IDs or @usernames")
+	regex := eventsFlags.String("regex", "", "Only messages whose text matches this regular expression")
+	onlyMentions := eventsFlags.Bool("only-mentions", false, "Only messages that mention this account")
+	onlyIncoming := eventsFlags.Bool("only-incoming", false, "Skip messages sent by this account")
+	hasMedia := eventsFlags.Bool("has-media", false, "Only messages with media")
+	chatTypes := eventsFlags.String("chat-types", "", "Only these chat types: user, chat, supergroup, channel")
+	filterExpr := eventsFlags.String("filter", "", `Filter expression, e.g. 'chat_type == "supergroup" && text.contains("urgent")'`)
+	sinkSpec := eventsFlags.String("sink", SinkStdout, "Where to deliver events: stdout, webhook, nats, kafka, redis, file:///path.ndjson or sqlite:///path.db")
+	sinkURL := eventsFlags.String("url", "", "Webhook URL or broker address (nats://host:4222, host:9092[,host2:9092], redis://host:6379/0)")
+	webhookSecret := eventsFlags.String("webhook-secret", "", "Secret for HMAC-SHA256 request signing (or WEBHOOK_SECRET env)")
+	var webhookHeaders stringList
+	eventsFlags.Var(&webhookHeaders, "webhook-header", `Extra request header "Name: value" (can be repeated)`)
+	webhookTimeout := eventsFlags.Duration("webhook-timeout", 10*time.Second, "Timeout of a single webhook request")
+	webhookRetryTime := eventsFlags.Duration("webhook-retry-time", time.Minute, "How long to retry a failed delivery with exponential backoff (0 = until stopped)")
+	webhookQueueDir := eventsFlags.String("webhook-queue-dir", "", "Directory where events are stored before delivery; enables batching and background retries")
+	batchSize := eventsFlags.Int("batch-size", 1, "Number of events per webhook request; more than 1 sends a JSON array (requires --webhook-queue-dir)")
+	batchInterval := eventsFlags.Duration("batch-interval", time.Second, "Maximum time to accumulate a webhook batch")
+	subject := eventsFlags.String("subject", "", "Broker subject/topic/stream template with {account}, {chat_id}, {chat_type}, {type}, {user_id}")
+	natsJetStream := eventsFlags.Bool("nats-jetstream", false, "Publish to NATS JetStream and wait for acknowledgements")
+	redisMaxLen := eventsFlags.Int64("redis-maxlen", 0, "Approximate maximum length of the Redis stream (0 = unlimited)")
+	outboxDir := eventsFlags.String("outbox-dir", "", "Directory for events the broker did not acknowledge, published later in order")
+	rotateSize := eventsFlags.Int64("rotate-size", 100, "Rotate the file sink when it exceeds this size in MB (0 = never)")
+	rotateInterval := eventsFlags.Duration("rotate-interval", 24*time.Hour, "Rotate the file sink at least this often (0 = never)")
+	compress := eventsFlags.Bool("compress", true, "Gzip rotated files of the file sink")
+
+	// Флаги из файла конфигурации демона идут первыми, чтобы флаги командной строки их переопределяли
+	daemon.Args = args
+	if command == CommandDaemon {
+		if path := daemonConfigPath(args); path != "" {
+			fileArgs, err := readDaemonConfigFile(path)
+			if err != nil {
+				return Config{Command: command}, err
+			}
+			args = append(fileArgs, args...)
+		}
+	}
+
+	// Парсим аргументы после команды
+	if err := eventsFlags.Parse(args); err != nil {
+		return Config{Command: command}, err
+	}
+
+	// Если запрошена справка
+	if *authArgs.help && !reload {
+		printHelp(eventsFlags)
+		os.Exit(0)
+	}
+
+	authConfig, err := authArgs.authConfig()
+	if err != nil {
+		printHelp(eventsFlags)
+		return Config{Command: command}, err
+	}
+
+	if *stateFile == "" {
+		printHelp(eventsFlags)
+		return Config{Command: command}, fmt.Errorf("state-file must not be empty")
+	}
+
+	filter := EventFilterOptions{
+		Chats:        splitList(*chats),
+		ExcludeChats: splitList(*excludeChats),
+		From:         splitList(*from),
+		Regex:        *regex,
+		OnlyMentions: *onlyMentions,
+		OnlyIncoming: *onlyIncoming,
+		HasMedia:     *hasMedia,
+		ChatTypes:    splitList(*chatTypes),
+		Expr:         *filterExpr,
+	}
+	for _, t := range splitList(*types) {
+		filter.Types = append(filter.Types, EventType(t))
+	}
+	if err := filter.validate(); err != nil {
+		printHelp(eventsFlags)
+		return Config{Command: command}, err
+	}
+
+	if *webhookSecret == "" {
+		*webhookSecret = os.Getenv("WEBHOOK_SECRET")
+	}
+	sinkType, sinkPath := parseSinkSpec(*sinkSpec)
+	switch sinkType {
+	case SinkStdout:
+	case SinkWebhook:
+		if *sinkURL == "" {
+			printHelp(eventsFlags)
+			return Config{Command: command}, fmt.Errorf("url is required for webhook sink")
+		}
+		if *batchSize < 1 {
+			printHelp(eventsFlags)
+			return Config{Command: command}, fmt.Errorf("batch-size must be at least 1")
+		}
+		if *batchSize > 1 && *webhookQueueDir == "" {
+			printHelp(eventsFlags)
+			return Config{Command: command}, fmt.Errorf("batch-size greater than 1 requires webhook-queue-dir")
+		}
+	case SinkNATS, SinkKafka, SinkRedis:
+		if *sinkURL == "" {
+			printHelp(eventsFlags)
+			return Config{Command: command}, fmt.Errorf("url is required for %s sink", sinkType)
+		}
+		if _, err := newSubjectTemplate(*subject); err != nil {
+			printHelp(eventsFlags)
+			return Config{Command: command}, err
+		}
+		if *redisMaxLen < 0 {
+			printHelp(eventsFlags)
+			return Config{Command: command}, fmt.Errorf("redis-maxlen must not be negative")
+		}
+	case SinkFile, SinkSQLite:
+		if sinkPath == "" {
+			printHelp(eventsFlags)
+			return Config{Command: command}, fmt.Errorf("path is required for %s sink, e.g. %s:///var/log/tg/events", sinkType, sinkType)
+		}
+		if *rotateSize < 0 || *rotateInterval < 0 {
+			printHelp(eventsFlags)
+			return Config{Command: command}, fmt.Errorf("rotate-size and rotate-interval must not be negative")
+		}
+	default:
+		printHelp(eventsFlags)
+		return Config{Command: command}, fmt.Errorf("unknown sink %q: expected stdout, webhook, nats, kafka, redis, file:///path or sqlite:///path", *sinkSpec)
+	}
+
+	if daemon.MaxBackoff <= 0 && command == CommandDaemon {
+		printHelp(eventsFlags)
+		return Config{Command: command}, fmt.Errorf("max-backoff must be positive")
+	}
+
+	// Создаем и возвращаем конфигурацию
+	return Config{
+		Command:    command,
+		AuthConfig: authConfig,
+		Events: EventsOptions{
+			Timeout:     *timeout,
+			StateFile:   *stateFile,
+			Fresh:       *fresh,
+			MetricsAddr: *metricsAddr,
+			Filter:      filter,
+			Sink: SinkOptions{
+				Type: sinkType,
+				Webhook: WebhookOptions{
+					URL:           *sinkURL,
+					Secret:        *webhookSecret,
+					Headers:       webhookHeaders,
+					Timeout:       *webhookTimeout,
+					RetryTime:     *webhookRetryTime,
+					QueueDir:      *webhookQueueDir,
+					BatchSize:     *batchSize,
+					BatchInterval: *batchInterval,
+				},
+				Broker: BrokerOptions{
+					URL:       *sinkURL,
+					Subject:   *subject,
+					JetStream: *natsJetStream,
+					MaxLen:    *redisMaxLen,
+					OutboxDir: *outboxDir,
+				},
+				File: FileSinkOptions{
+					Path:     sinkPath,
+					MaxSize:  *rotateSize << 20,
+					MaxAge:   *rotateInterval,
+					Compress: *compress,
+				},
+				SQLitePath: sinkPath,
+			},
+		},
+		Daemon: daemon,
+	}, nil
+}
+
 // PrintHelp выводит общую справку по приложению
 func PrintHelp() {
 	fmt.Println("Telegram Authentication Client")
@@ -266,6 +1194,20 @@ func PrintHelp() {
 	fmt.Println("  chats      Get list of all chats in JSON format")
 	fmt.Println("  messages   Get messages from a specific chat in JSON format")
 	fmt.Println("  events     Listen for Telegram events and print them in JSON format")
+	fmt.Println("  daemon     Listen for events as a supervised service with auto-reconnect")
+	fmt.Println("  search     Search messages in a chat or across all chats")
+	fmt.Println("  send       Send a text message to a chat")
+	fmt.Println("  edit       Edit the text of a message")
+	fmt.Println("  delete     Delete messages")
+	fmt.Println("  pin        Pin a message")
+	fmt.Println("  unpin      Unpin a message")
+	fmt.Println("  forward    Forward messages to another chat")
+	fmt.Println("  download   Download media of a message")
+	fmt.Println("  replies    Get replies to a message or comments under a channel post")
+	fmt.Println("  topics     List forum topics of a supergroup")
+	fmt.Println("  read       Mark messages in a chat as read")
+	fmt.Println("  typing     Show typing or upload status in a chat")
+	fmt.Println("  status     Set account presence to online or offline")
 	fmt.Println("  help       Display this help message")
 	fmt.Println("  test       Run a test to check if application works properly")
 	fmt.Println("\nExamples:")
@@ -278,8 +1220,26 @@ func PrintHelp() {
 	fmt.Println("    ./telegram-auth chats")
 	fmt.Println("\n  Get messages from a chat:")
 	fmt.Println("    ./telegram-auth messages --chat-id=-1001234567890 --limit=50")
+	fmt.Println("\n  Export the last week of a chat as NDJSON:")
+	fmt.Println("    ./telegram-auth messages --chat-id=-1001234567890 --all --since=7d > history.ndjson")
 	fmt.Println("\n  Listen for Telegram events:")
 	fmt.Println("    ./telegram-auth events --timeout=600")
+	fmt.Println("\n  Run events as a service, reloading flags from a file on SIGHUP:")
+	fmt.Println("    ./telegram-auth daemon --config=/etc/tg/events.conf --sink=sqlite:///var/lib/tg/events.db")
+	fmt.Println("\n  Search for a phrase in one chat:")
+	fmt.Println("    ./telegram-auth search --chat=-1001234567890 --query=invoice --since=30d")
+	fmt.Println("\n  Send a formatted message:")
+	fmt.Println("    echo '**Deploy finished**' | ./telegram-auth send --chat=@team_alerts --parse-mode=markdown")
+	fmt.Println("\n  Send a report as a document:")
+	fmt.Println("    ./telegram-auth send --chat=@team_reports --file=report.pdf --caption='Nightly report'")
+	fmt.Println("\n  Delete messages for everyone:")
+	fmt.Println("    ./telegram-auth delete --chat=@alice --ids=10,11,12 --revoke")
+	fmt.Println("\n  Get comments under a channel post:")
+	fmt.Println("    ./telegram-auth replies --chat=@announcements --msg-id=1234 --limit=100")
+	fmt.Println("\n  Get the history of one forum topic:")
+	fmt.Println("    ./telegram-auth messages --chat-id=-1001234567890 --topic=42 --limit=100")
+	fmt.Println("\n  Read a chat and show typing for 5 seconds before replying:")
+	fmt.Println("    ./telegram-auth read --chat=@customer --mentions && ./telegram-auth typing --chat=@customer --duration=5s")
 	fmt.Println("\n  Show help for login command:")
 	fmt.Println("    ./telegram-auth login --help")
 }
@@ -332,6 +1292,13 @@ func printMessagesHelp(fs *flag.FlagSet) {
 	fmt.Println("  - Chat ID is required and must be specified via --chat-id flag or CHAT_ID environment variable")
 	fmt.Println("  - Use the 'chats' command to get the list of available chats and their IDs")
 	fmt.Println("  - Chat IDs for groups and channels are usually negative numbers")
+	fmt.Println("  - With --all the whole history is streamed to stdout as NDJSON, one message per line")
+	fmt.Println("  - --since and --until accept RFC3339 (2024-01-02T15:04:05Z), a date (2024-01-02) or a relative age (30m, 12h, 7d, 2w)")
+	fmt.Println("  - Progress and diagnostics are printed to stderr")
+	fmt.Println("  - With --download-media files are saved next to each other and local_path/local_size are added to messages")
+	fmt.Println("  - Interrupted downloads leave a .part file and are resumed on the next run")
+	fmt.Println("  - Media is always fetched from the DC that stores it: CDN redirects are not supported")
+	fmt.Println("  - With --render the text with its formatting is added as 'rendered'; markdown output can be sent back with send --parse-mode markdown")
 }
 
 // printEventsHelp выводит справку по команде events
@@ -347,8 +1314,258 @@ func printEventsHelp(fs *flag.FlagSet) {
 	fmt.Println("  APP_ID   - Telegram app ID")
 	fmt.Println("  APP_HASH - Telegram app hash")
 	fmt.Println("  PHONE    - Phone number in international format")
+	fmt.Println("  WEBHOOK_SECRET - Secret for webhook request signing")
 	fmt.Println("\nNotes:")
 	fmt.Println("  - Press Ctrl+C to stop listening for events")
 	fmt.Println("  - Set timeout to automatically stop after specified number of seconds")
 	fmt.Println("  - Events are printed in JSON format to stdout")
+	fmt.Println("  - Message events include message_info in the same shape as the messages command")
+	fmt.Println("  - Joins, leaves, kicks, bans, promotions and service messages are emitted as chat_action,")
+	fmt.Println("    read receipts as read events. In chat_action user_id is the affected user and")
+	fmt.Println("    chat_action.actor_id the one who acted")
+	fmt.Println("  - A membership change may be emitted twice: from the service message (with message_id,")
+	fmt.Println("    action chat_add_user, chat_delete_user...) and from the participant update (added, left...)")
+	fmt.Println("  - If the server drops missed updates of a channel, a channel_too_long event with its chat_id")
+	fmt.Println("    is emitted: some events were lost and the chat history should be fetched with messages.")
+	fmt.Println("    Only --types and the chat filters apply to it")
+	fmt.Println("  - All filter flags must match; --filter is combined with them using AND")
+	fmt.Println("  - With --sink webhook each event (or a JSON array with --batch-size > 1) is POSTed to --url;")
+	fmt.Println("    with a secret, X-Webhook-Signature is sha256=HMAC-SHA256(secret, X-Webhook-Timestamp + \".\" + body)")
+	fmt.Println("  - Without --webhook-queue-dir each event is POSTed before the next one is handled, retrying")
+	fmt.Println("    for --webhook-retry-time; if it still fails, tracking stops and the event is replayed later")
+	fmt.Println("  - With --webhook-queue-dir events are written to disk first and sent in the background in order;")
+	fmt.Println("    after a failure the queue is retried every 30s and survives restarts")
+	fmt.Println("  - Events rejected with a 4xx status (except 408 and 429) are not retried")
+	fmt.Println("  - With --sink nats, kafka or redis each event is published after the broker acknowledges it;")
+	fmt.Println("    the default subject is tg.{account}.{chat_id}.{type} (NATS), tg.{account}.events (Kafka topic)")
+	fmt.Println("    or tg:{account}:events (Redis stream). The message key is the chat ID, so events of one chat")
+	fmt.Println("    keep their order within a Kafka partition")
+	fmt.Println("  - With --outbox-dir events the broker did not acknowledge are saved locally and published")
+	fmt.Println("    later in the original order; new events wait behind them")
+	fmt.Println("  - With --sink file:///path.ndjson events are appended one JSON per line; the file is rotated")
+	fmt.Println("    by --rotate-size and --rotate-interval into path-YYYYMMDD-HHMMSS.ndjson, gzipped with --compress")
+	fmt.Println("  - With --sink sqlite:///path.db messages, edits, deletes and user statuses are stored in tables")
+	fmt.Println("    of the same name; edits update and deletes mark (deleted_at) the stored messages,")
+	fmt.Println("    other events are kept as JSON in the events table")
+	fmt.Println("  - Update state is saved to --state-file at most once a second and on exit; after a restart, events missed")
+	fmt.Println("    while the client was down are replayed first (use --fresh to skip them)")
+	fmt.Println("  - If the sink rejects an event, tracking stops with an error and the update state is not")
+	fmt.Println("    saved past that event, so it is delivered again on the next start (at-least-once);")
+	fmt.Println("    events accepted by an asynchronous sink before a crash are covered only by its disk queue")
+	fmt.Println("  - With --metrics-addr Prometheus metrics are served on /metrics: tg_events_received_total,")
+	fmt.Println("    tg_sink_delivery_duration_seconds, tg_sink_delivery_failures_total, tg_rpc_calls_total,")
+	fmt.Println("    tg_flood_wait_seconds_total, tg_reconnects_total, tg_update_difference_requests_total")
+	fmt.Println("    and tg_last_event_timestamp_seconds")
+	fmt.Println("\nFilter expressions:")
+	fmt.Println("  Fields:    type, chat_id, chat_type, chat_title, user_id, username, first_name, last_name,")
+	fmt.Println("             message_id, topic_id, reply_to, text, action, media_type,")
+	fmt.Println("             mentioned, outgoing, has_media, forwarded")
+	fmt.Println("  Operators: ! && || == != < <= > >= in [..]")
+	fmt.Println("  Methods:   text.contains(s), startsWith(s), endsWith(s), matches(re), lower()")
+	fmt.Println("\nExamples:")
+	fmt.Println("  telegram-auth events --types message --only-mentions --chats @team,-1001234567890")
+	fmt.Println(`  telegram-auth events --filter 'chat_type == "supergroup" && text.lower().contains("urgent")'`)
+	fmt.Println("  telegram-auth events --sink kafka --url localhost:9092 --outbox-dir ./outbox")
+	fmt.Println("  telegram-auth events --sink nats --url nats://localhost:4222 --nats-jetstream")
+	fmt.Println("  telegram-auth events --sink file:///var/log/tg/events.ndjson --rotate-size 50")
+	fmt.Println("  telegram-auth events --sink sqlite:///var/lib/tg/events.db")
+}
+
+// printDaemonHelp выводит справку по команде daemon
+func printDaemonHelp(fs *flag.FlagSet) {
+	fmt.Println("Telegram Authentication Client - Daemon")
+	fmt.Println("-------------------------------------")
+	fmt.Println("Listen for Telegram events as a long-running service: reconnect on errors,")
+	fmt.Println("reload configuration on SIGHUP and deliver pending events on SIGTERM.")
+	fmt.Println("\nUsage:")
+	fmt.Println("  telegram-auth daemon [options]")
+	fmt.Println("\nOptions:")
+	fs.PrintDefaults()
+	fmt.Println("\nEnvironment Variables:")
+	fmt.Println("  APP_ID   - Telegram app ID")
+	fmt.Println("  APP_HASH - Telegram app hash")
+	fmt.Println("  PHONE    - Phone number in international format")
+	fmt.Println("  WEBHOOK_SECRET - Secret for webhook request signing")
+	fmt.Println("\nNotes:")
+	fmt.Println("  - Accepts all options of the events command except --timeout")
+	fmt.Println("  - The session must already exist: run 'login' first, the daemon never asks for a code")
+	fmt.Println("  - After an error the client reconnects with jittered exponential backoff up to --max-backoff;")
+	fmt.Println("    update state is kept in --state-file, so events missed while disconnected are replayed")
+	fmt.Println("  - --fresh applies only to the first start, not to reconnects or reloads")
+	fmt.Println("  - If the session is revoked (AUTH_KEY_UNREGISTERED and other 401 errors) the daemon prints")
+	fmt.Println("    an ALERT line, POSTs {\"alert\":\"session_revoked\",...} to --alert-url and exits with code 2")
+	fmt.Println("  - On SIGHUP the command line and --config file are parsed again and tracking restarts with")
+	fmt.Println("    the new options; on errors the current configuration is kept")
+	fmt.Println("  - On SIGTERM or Ctrl+C events already accepted by the sink are delivered before exit")
+	fmt.Println("  - --metrics-addr is read only at start; the metrics server keeps running across reconnects")
+	fmt.Println("    and reloads (see 'events --help' for the list of metrics)")
+	fmt.Println("\nConfig file:")
+	fmt.Println("  # One flag per line; command-line flags override the file")
+	fmt.Println("  sink = webhook")
+	fmt.Println("  url = https://example.com/hook")
+	fmt.Println("  chats = @team,-1001234567890")
+	fmt.Println("  only-mentions")
+}
+
+// printSearchHelp выводит справку по команде search
+func printSearchHelp(fs *flag.FlagSet) {
+	fmt.Println("Telegram Authentication Client - Search")
+	fmt.Println("-------------------------------------")
+	fmt.Println("Search messages in a specific chat or across all chats in JSON format.")
+	fmt.Println("\nUsage:")
+	fmt.Println("  telegram-auth search [options]")
+	fmt.Println("\nOptions:")
+	fs.PrintDefaults()
+	fmt.Println("\nEnvironment Variables:")
+	fmt.Println("  APP_ID   - Telegram app ID")
+	fmt.Println("  APP_HASH - Telegram app hash")
+	fmt.Println("  PHONE    - Phone number in international format")
+	fmt.Println("\nNotes:")
+	fmt.Println("  - Without --chat the search runs across all chats (messages.searchGlobal)")
+	fmt.Println("  - --from works only together with --chat")
+	fmt.Println("  - With --all results are streamed to stdout as NDJSON, one message per line")
+	fmt.Println("  - With --render the text with its formatting is added as 'rendered' (markdown, html or plain)")
+}
+
+// printRepliesHelp выводит справку по команде replies
+func printRepliesHelp(fs *flag.FlagSet) {
+	fmt.Println("Telegram Authentication Client - Replies")
+	fmt.Println("--------------------------------------")
+	fmt.Println("Get replies to a message or comments under a channel post in JSON format.")
+	fmt.Println("\nUsage:")
+	fmt.Println("  telegram-auth replies [options]")
+	fmt.Println("\nOptions:")
+	fs.PrintDefaults()
+	fmt.Println("\nEnvironment Variables:")
+	fmt.Println("  APP_ID   - Telegram app ID")
+	fmt.Println("  APP_HASH - Telegram app hash")
+	fmt.Println("  PHONE    - Phone number in international format")
+	fmt.Println("\nNotes:")
+	fmt.Println("  - For a channel post the comments are taken from the linked discussion group")
+	fmt.Println("  - The 'thread' object holds the reply count and read state of the discussion")
+	fmt.Println("  - With --all replies are streamed to stdout as NDJSON and the thread state is printed to stderr")
+}
+
+// printSendHelp выводит справку по команде send
+func printSendHelp(fs *flag.FlagSet) {
+	fmt.Println("Telegram Authentication Client - Send")
+	fmt.Println("-----------------------------------")
+	fmt.Println("Send a text message to a chat and print it in JSON format.")
+	fmt.Println("\nUsage:")
+	fmt.Println("  telegram-auth send [options]")
+	fmt.Println("\nOptions:")
+	fs.PrintDefaults()
+	fmt.Println("\nEnvironment Variables:")
+	fmt.Println("  APP_ID   - Telegram app ID")
+	fmt.Println("  APP_HASH - Telegram app hash")
+	fmt.Println("  PHONE    - Phone number in international format")
+	fmt.Println("\nNotes:")
+	fmt.Println("  - With --text=\"-\" the text is read from stdin; if --text is omitted, only piped stdin is read")
+	fmt.Println("  - --file can be repeated up to 10 times; several files are sent as an album. Photos and videos")
+	fmt.Println("    can be mixed; documents and audio files can only be grouped with files of the same kind")
+	fmt.Println("  - Video and audio duration and size are detected with ffprobe (included in the Docker image).")
+	fmt.Println("    Without it --as video fails and detected videos are sent as documents")
+	fmt.Println("  - Markdown: **bold**, *italic*, __underline__, ~~strike~~, ||spoiler||, `code`, ```pre```, [text](url)")
+	fmt.Println("  - HTML: <b>, <i>, <u>, <s>, <tg-spoiler>, <code>, <pre>, <a href=\"...\">")
+}
+
+// printMessageActionHelp выводит справку по командам управления сообщениями
+func printMessageActionHelp(command CommandType, description string, fs *flag.FlagSet) {
+	title := fmt.Sprintf("Telegram Authentication Client - %s%s", strings.ToUpper(string(command[:1])), command[1:])
+	fmt.Println(title)
+	fmt.Println(strings.Repeat("-", len(title)))
+	fmt.Println(description)
+	fmt.Println("\nUsage:")
+	fmt.Printf("  telegram-auth %s [options]\n", command)
+	fmt.Println("\nOptions:")
+	fs.PrintDefaults()
+	fmt.Println("\nEnvironment Variables:")
+	fmt.Println("  APP_ID   - Telegram app ID")
+	fmt.Println("  APP_HASH - Telegram app hash")
+	fmt.Println("  PHONE    - Phone number in international format")
+}
+
+// stringList реализует flag.Value для повторяемых строковых флагов
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// splitList разбирает список значений, разделенных запятыми, пропуская пустые
+func splitList(value string) []string {
+	var items []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			items = append(items, part)
+		}
+	}
+	return items
+}
+
+// parseIDList разбирает список ID сообщений, разделенных запятыми
+func parseIDList(value string) ([]int, error) {
+	var ids []int
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.Atoi(part)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("invalid message ID %q", part)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// parseTimeBound разбирает границу по времени: RFC3339, дату или относительный возраст (7d, 12h)
+func parseTimeBound(value string) (time.Time, error) {
+	return parseTimeArg(value, -1)
+}
+
+// parseScheduleTime разбирает время отложенной отправки: RFC3339, дату или задержку (30m, 2h, 1d)
+func parseScheduleTime(value string) (time.Time, error) {
+	return parseTimeArg(value, 1)
+}
+
+// parseTimeArg разбирает абсолютное или относительное время; direction задает сдвиг в прошлое (-1) или будущее (1)
+func parseTimeArg(value string, direction int) (time.Time, error) {
+	value = strings.TrimSpace(strings.TrimPrefix(value, "+"))
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+
+	// Относительное время: дни и недели Go не поддерживает, считаем сами
+	unit := value[len(value)-1]
+	if unit == 'd' || unit == 'w' {
+		n, err := strconv.Atoi(value[:len(value)-1])
+		if err != nil || n < 0 {
+			return time.Time{}, fmt.Errorf("cannot parse %q", value)
+		}
+		days := n
+		if unit == 'w' {
+			days = n * 7
+		}
+		return time.Now().AddDate(0, 0, direction*days), nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("cannot parse %q: expected RFC3339, YYYY-MM-DD or relative time like 7d", value)
+	}
+	return time.Now().Add(time.Duration(direction) * d), nil
 }
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/gotd/td/telegram/auth"
+)
+
+const (
+	daemonHealthyRun   = time.Minute      // После такой работы без ошибок задержка переподключения сбрасывается
+	daemonAlertTimeout = 10 * time.Second // Таймаут отправки оповещения
+)
+
+// errSessionRevoked возвращается, когда сессия недействительна и без нового входа работать нельзя
+var errSessionRevoked = errors.New("telegram session is not authorized or was revoked")
+
+// DaemonOptions задает наблюдение за отслеживанием событий
+type DaemonOptions struct {
+	ConfigFile string        // Файл с флагами, перечитывается по SIGHUP
+	MaxBackoff time.Duration // Максимальная задержка между попытками переподключения
+	AlertURL   string        // Куда отправить оповещение об отозванной сессии
+	Args       []string      // Аргументы командной строки для повторного разбора при перезагрузке
+}
+
+// RunDaemon отслеживает события и перезапускает клиент при ошибках со случайной
+// экспоненциальной задержкой. Состояние обновлений хранится в --state-file, поэтому
+// после переподключения пропущенные события догоняются. Сигнал из reload
+// перечитывает конфигурацию; отмена ctx останавливает демон после доставки принятых событий
+func RunDaemon(ctx context.Context, config Config, reload <-chan os.Signal) error {
+	policy := backoff.NewExponentialBackOff()
+	policy.InitialInterval = time.Second
+	policy.RandomizationFactor = 0.5
+	policy.MaxInterval = config.Daemon.MaxBackoff
+	policy.MaxElapsedTime = 0
+
+	for {
+		opts := config.Events
+		opts.RequireSession = true
+
+		started := time.Now()
+		runCtx, cancelRun := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func() {
+			done <- GetEvents(runCtx, config.AuthConfig, opts)
+		}()
+
+		var err error
+		var next *Config
+	wait:
+		for {
+			select {
+			case err = <-done:
+				break wait
+			case <-reload:
+				if cfg, ok := reloadDaemonConfig(config); ok {
+					// GetEvents доставит уже принятые события и вернется
+					next = &cfg
+					cancelRun()
+				}
+			}
+		}
+		cancelRun()
+
+		// --fresh относится только к первому запуску: после переподключения пропущенное нужно догнать
+		config.Events.Fresh = false
+
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case next != nil:
+			config = *next
+			config.Events.Fresh = false
+			policy.Reset()
+			fmt.Fprintln(os.Stderr, "Configuration reloaded, restarting events tracking...")
+			continue
+		case isSessionRevoked(err):
+			sendDaemonAlert(config.Daemon.AlertURL, err)
+			return fmt.Errorf("%w: %v", errSessionRevoked, err)
+		case err == nil:
+			err = errors.New("connection closed")
+		}
+
+		metricReconnects.Inc()
+		if time.Since(started) >= daemonHealthyRun {
+			policy.Reset()
+		}
+		delay := policy.NextBackOff()
+		fmt.Fprintf(os.Stderr, "Warning: events tracking stopped: %v; reconnecting in %s\n", err, delay.Round(100*time.Millisecond))
+
+		// Ожидание прерывается остановкой и перезагрузкой конфигурации
+		timer := time.NewTimer(delay)
+	sleep:
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil
+			case <-timer.C:
+				break sleep
+			case <-reload:
+				if cfg, ok := reloadDaemonConfig(config); ok {
+					config = cfg
+					config.Events.Fresh = false
+					timer.Stop()
+					break sleep
+				}
+			}
+		}
+	}
+}
+
+// reloadDaemonConfig перечитывает флаги и файл конфигурации; при ошибке остается текущая конфигурация
+func reloadDaemonConfig(current Config) (Config, bool) {
+	fmt.Fprintln(os.Stderr, "Reloading configuration...")
+	config, err := parseEventsConfig(CommandDaemon, current.Daemon.Args, true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to reload configuration, keeping the current one: %v\n", err)
+		return current, false
+	}
+	return config, true
+}
+
+// isSessionRevoked проверяет, что ошибка вызвана недействительной сессией (AUTH_KEY_UNREGISTERED и другие 401)
+func isSessionRevoked(err error) bool {
+	return errors.Is(err, errSessionRevoked) || auth.IsUnauthorized(err)
+}
+
+// sendDaemonAlert сообщает об отозванной сессии в stderr и, если задан адрес, POST-запросом
+func sendDaemonAlert(url string, cause error) {
+	fmt.Fprintf(os.Stderr, "ALERT: Telegram session is no longer valid, run 'login' again: %v\n", cause)
+	if url == "" {
+		return
+	}
+
+	body, _ := json.Marshal(map[string]any{
+		"alert": "session_revoked",
+		"error": cause.Error(),
+		"time":  time.Now().Unix(),
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), daemonAlertTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to send alert: %v\n", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to send alert: %v\n", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		fmt.Fprintf(os.Stderr, "Warning: alert endpoint responded with %s\n", resp.Status)
+	}
+}
+
+// daemonConfigPath находит значение --config среди аргументов до их полного разбора
+func daemonConfigPath(args []string) string {
+	var path string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if !hasValue && i+1 < len(args) {
+			i++
+			value = args[i]
+		}
+		path = value
+	}
+	return path
+}
+
+// readDaemonConfigFile читает флаги из файла: строки 'name = value' или 'name' для
+// булевых флагов; пустые строки и строки с # пропускаются, имя можно повторять
+func readDaemonConfigFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer file.Close()
+
+	var args []string
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, value, hasValue := strings.Cut(text, "=")
+		name = strings.TrimLeft(strings.TrimSpace(name), "-")
+		if name == "" {
+			return nil, fmt.Errorf("%s:%d: flag name is empty", path, line)
+		}
+		if name == "config" {
+			return nil, fmt.Errorf("%s:%d: config cannot be set from the config file", path, line)
+		}
+		if !hasValue {
+			args = append(args, "--"+name)
+			continue
+		}
+		args = append(args, "--"+name+"="+unquoteConfigValue(strings.TrimSpace(value)))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return args, nil
+}
+
+// unquoteConfigValue снимает парные кавычки вокруг значения
+func unquoteConfigValue(value string) string {
+	if len(value) >= 2 {
+		if q := value[0]; (q == '"' || q == '\'') && value[len(value)-1] == q {
+			return value[1 : len(value)-1]
+		}
+	}
+	return value
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/downloader"
+	"github.com/gotd/td/tg"
+)
+
+// downloadPartSize размер одной части файла; кратен 4 КБ и делит 1 МБ, как требует upload.getFile
+const downloadPartSize = 512 * 1024
+
+// defaultNameTemplate шаблон имени скачанного файла по умолчанию
+const defaultNameTemplate = "{chat_id}_{msg_id}_{name}"
+
+// DownloadOptions задает параметры скачивания медиа
+type DownloadOptions struct {
+	Chat         string // Чат: ID или @username
+	ID           int    // ID сообщения с медиа
+	Dir          string // Каталог для сохранения файлов
+	Threads      int    // Количество частей, скачиваемых параллельно
+	NameTemplate string // Шаблон имени файла
+}
+
+// mediaFile описывает скачиваемый файл из сообщения
+type mediaFile struct {
+	location tg.InputFileLocationClass
+	size     int64
+	name     string
+	ext      string
+	kind     string
+}
+
+// mediaDownloader скачивает медиа из сообщений в локальный каталог
+type mediaDownloader struct {
+	api          *tg.Client
+	dir          string
+	threads      int
+	nameTemplate string
+}
+
+// newMediaDownloader создает загрузчик медиа с параметрами по умолчанию
+func newMediaDownloader(api *tg.Client, dir string, threads int, nameTemplate string) *mediaDownloader {
+	if threads <= 0 {
+		threads = 4
+	}
+	if nameTemplate == "" {
+		nameTemplate = defaultNameTemplate
+	}
+	return &mediaDownloader{
+		api:          api,
+		dir:          dir,
+		threads:      threads,
+		nameTemplate: nameTemplate,
+	}
+}
+
+// DownloadMedia скачивает медиа из сообщения и выводит сообщение с путем к файлу в формате JSON
+func DownloadMedia(ctx context.Context, config AuthConfig, opts DownloadOptions) error {
+	return runAuthorized(ctx, config, func(ctx context.Context, client *telegram.Client) error {
+		api := client.API()
+
+		peer, chatID, err := resolvePeer(ctx, client, opts.Chat)
+		if err != nil {
+			return fmt.Errorf("failed to resolve chat: %w", err)
+		}
+
+		// Сообщения каналов запрашиваются отдельным методом
+		ids := []tg.InputMessageClass{&tg.InputMessageID{ID: opts.ID}}
+		var history tg.MessagesMessagesClass
+		if channel, ok := inputChannelFromPeer(peer); ok {
+			history, err = api.ChannelsGetMessages(ctx, &tg.ChannelsGetMessagesRequest{Channel: channel, ID: ids})
+		} else {
+			history, err = api.MessagesGetMessages(ctx, ids)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get message: %w", err)
+		}
+
+		raw, err := historyMessages(history)
+		if err != nil {
+			return err
+		}
+		extracted, err := extractMessages(history, chatID)
+		if err != nil {
+			return fmt.Errorf("failed to extract messages: %w", err)
+		}
+
+		var msg *tg.Message
+		for _, m := range raw {
+			if message, ok := m.(*tg.Message); ok && message.ID == opts.ID {
+				msg = message
+			}
+		}
+		if msg == nil || len(extracted.Messages) == 0 {
+			return fmt.Errorf("message %d not found in chat %d", opts.ID, chatID)
+		}
+
+		info := extracted.Messages[0]
+		downloader := newMediaDownloader(api, opts.Dir, opts.Threads, opts.NameTemplate)
+		if err := downloader.download(ctx, chatID, msg, &info); err != nil {
+			return err
+		}
+		if info.LocalPath == "" {
+			return fmt.Errorf("message %d has no downloadable media", opts.ID)
+		}
+		return printJSON(info)
+	})
+}
+
+// download скачивает медиа сообщения и записывает путь и размер файла в info
+func (d *mediaDownloader) download(ctx context.Context, chatID int64, msg *tg.Message, info *MessageInfo) error {
+	file, ok := mediaFileFromMessage(msg)
+	if !ok {
+		return nil
+	}
+
+	if err := os.MkdirAll(d.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create download directory: %w", err)
+	}
+
+	path := filepath.Join(d.dir, d.fileName(chatID, msg, file))
+	fmt.Fprintf(os.Stderr, "Downloading %s of message %d to %s...\n", file.kind, msg.ID, path)
+
+	size, err := d.fetchFile(ctx, file, path)
+	if err != nil {
+		return fmt.Errorf("failed to download media of message %d: %w", msg.ID, err)
+	}
+
+	info.LocalPath = path
+	info.LocalSize = size
+	return nil
+}
+
+// fileName формирует имя файла по шаблону
+func (d *mediaDownloader) fileName(chatID int64, msg *tg.Message, file mediaFile) string {
+	name := file.name
+	if name == "" {
+		name = file.kind + file.ext
+	}
+
+	replacer := strings.NewReplacer(
+		"{chat_id}", strconv.FormatInt(chatID, 10),
+		"{msg_id}", strconv.Itoa(msg.ID),
+		"{date}", time.Unix(int64(msg.Date), 0).UTC().Format("20060102-150405"),
+		"{type}", file.kind,
+		"{name}", name,
+		"{ext}", file.ext,
+	)
+	result := replacer.Replace(d.nameTemplate)
+
+	// Имя файла не должно выходить за пределы каталога
+	result = strings.NewReplacer("/", "_", "\\", "_").Replace(result)
+	if result == "" || result == "." || result == ".." {
+		result = fmt.Sprintf("%d_%d%s", chatID, msg.ID, file.ext)
+	}
+	return result
+}
+
+// fetchFile скачивает файл загрузчиком gotd в несколько потоков, продолжая ранее
+// прерванную загрузку из файла .part
+func (d *mediaDownloader) fetchFile(ctx context.Context, file mediaFile, path string) (int64, error) {
+	// Уже скачанный файл не скачиваем повторно
+	if stat, err := os.Stat(path); err == nil && (file.size == 0 || stat.Size() == file.size) {
+		return stat.Size(), nil
+	}
+
+	partPath := path + ".part"
+	f, err := os.OpenFile(partPath, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open partial file: %w", err)
+	}
+	defer f.Close()
+
+	// .part всегда содержит непрерывное начало файла; продолжаем с границы целой части
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat partial file: %w", err)
+	}
+	resumed := stat.Size() / downloadPartSize * downloadPartSize
+	if file.size > 0 && resumed > file.size {
+		resumed = 0
+	}
+	if err := f.Truncate(resumed); err != nil {
+		return 0, fmt.Errorf("failed to truncate partial file: %w", err)
+	}
+	if resumed > 0 {
+		fmt.Fprintf(os.Stderr, "Resuming download from %d bytes\n", resumed)
+	}
+
+	// Загрузчик не умеет начинать с середины, поэтому уже скачанные части
+	// он получает из .part, а не из API. Запрос без cdn_supported означает,
+	// что сервер отдает файл из своего DC, а не перенаправляет на CDN: загрузчик
+	// gotd не дает включить CDN, и это ограничение описано в справке команды
+	w := newOrderedWriter(f, resumed, int64(d.threads)*downloadPartSize)
+	stop := context.AfterFunc(ctx, w.wake)
+	defer stop()
+
+	client := resumeClient{Client: d.api, part: f, resumed: resumed, writer: w}
+	_, err = downloader.NewDownloader().
+		WithPartSize(downloadPartSize).
+		Download(client, file.location).
+		WithThreads(d.threads).
+		Parallel(ctx, w)
+	if err != nil {
+		return 0, err
+	}
+	if len(w.pending) > 0 {
+		return 0, fmt.Errorf("download finished with %d parts missing", len(w.pending))
+	}
+
+	if err := f.Close(); err != nil {
+		return 0, fmt.Errorf("failed to close file: %w", err)
+	}
+	if err := os.Rename(partPath, path); err != nil {
+		return 0, fmt.Errorf("failed to rename partial file: %w", err)
+	}
+	return w.next, nil
+}
+
+// resumeClient отдает загрузчику уже скачанное начало файла из .part и не дает
+// потокам уходить дальше окна от еще не записанной части
+type resumeClient struct {
+	*tg.Client
+	part    *os.File
+	resumed int64 // Сколько байт начала файла уже есть в .part
+	writer  *orderedWriter
+}
+
+func (c resumeClient) UploadGetFile(ctx context.Context, request *tg.UploadGetFileRequest) (tg.UploadFileClass, error) {
+	if request.Offset+int64(request.Limit) > c.resumed {
+		if err := c.writer.waitFor(ctx, request.Offset); err != nil {
+			return nil, err
+		}
+		return withFloodWait(ctx, func() (tg.UploadFileClass, error) {
+			return c.Client.UploadGetFile(ctx, request)
+		})
+	}
+	data := make([]byte, request.Limit)
+	if _, err := c.part.ReadAt(data, request.Offset); err != nil {
+		return nil, fmt.Errorf("failed to read partial file: %w", err)
+	}
+	return &tg.UploadFile{Type: &tg.StorageFileUnknown{}, Bytes: data}, nil
+}
+
+// orderedWriter пишет части, приходящие из параллельных потоков, строго по
+// порядку: части, опередившие очередь, ждут в памяти. Так .part остается
+// непрерывным даже при аварийном завершении процесса. Запись идет из одной
+// горутины загрузчика, поэтому блокировать ее нельзя: размер очереди
+// ограничивается на стороне запросов через waitFor
+type orderedWriter struct {
+	mux     sync.Mutex
+	cond    *sync.Cond
+	file    *os.File
+	next    int64            // Сколько байт начала файла уже записано
+	window  int64            // На сколько байт запросы могут опережать next
+	pending map[int64][]byte // Части, ждущие записи, по смещению
+}
+
+// newOrderedWriter создает писателя, продолжающего файл с offset
+func newOrderedWriter(file *os.File, offset, window int64) *orderedWriter {
+	w := &orderedWriter{file: file, next: offset, window: window, pending: map[int64][]byte{}}
+	w.cond = sync.NewCond(&w.mux)
+	return w
+}
+
+// waitFor ждет, пока часть по смещению off не окажется в окне от
+// записанного начала файла. Часть по смещению next не ждет никогда,
+// поэтому загрузка всегда продвигается
+func (w *orderedWriter) waitFor(ctx context.Context, off int64) error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	for off >= w.next+w.window {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		w.cond.Wait()
+	}
+	return nil
+}
+
+// wake будит ожидающие потоки, например при отмене контекста
+func (w *orderedWriter) wake() {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	w.cond.Broadcast()
+}
+
+func (w *orderedWriter) WriteAt(p []byte, off int64) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	n := len(p)
+	// Части из .part уже записаны
+	if end := off + int64(n); end <= w.next {
+		return n, nil
+	} else if off < w.next {
+		p, off = p[w.next-off:], w.next
+	}
+	if off > w.next {
+		// Буфер загрузчика переиспользуется после возврата, поэтому копируем
+		w.pending[off] = append([]byte(nil), p...)
+		return n, nil
+	}
+
+	// Окно сдвинулось, ожидающие потоки могут продолжить
+	defer w.cond.Broadcast()
+	for {
+		if _, err := w.file.WriteAt(p, w.next); err != nil {
+			return 0, fmt.Errorf("failed to write file: %w", err)
+		}
+		w.next += int64(len(p))
+
+		var ok bool
+		if p, ok = w.pending[w.next]; !ok {
+			return n, nil
+		}
+		delete(w.pending, w.next)
+	}
+}
+
+// mediaFileFromMessage определяет расположение файла медиа в сообщении
+func mediaFileFromMessage(msg *tg.Message) (mediaFile, bool) {
+	media, ok := msg.GetMedia()
+	if !ok {
+		return mediaFile{}, false
+	}
+
+	switch m := media.(type) {
+	case *tg.MessageMediaPhoto:
+		photo, ok := m.Photo.(*tg.Photo)
+		if !ok {
+			return mediaFile{}, false
+		}
+		best := largestPhotoSize(photo.Sizes)
+		if best.sizeType == "" {
+			return mediaFile{}, false
+		}
+		return mediaFile{
+			location: &tg.InputPhotoFileLocation{
+				ID:            photo.ID,
+				AccessHash:    photo.AccessHash,
+				FileReference: photo.FileReference,
+				ThumbSize:     best.sizeType,
+			},
+			size: best.size,
+			ext:  ".jpg",
+			kind: "photo",
+		}, true
+	case *tg.MessageMediaDocument:
+		doc, ok := m.Document.(*tg.Document)
+		if !ok {
+			return mediaFile{}, false
+		}
+		file := mediaFile{
+			location: &tg.InputDocumentFileLocation{
+				ID:            doc.ID,
+				AccessHash:    doc.AccessHash,
+				FileReference: doc.FileReference,
+			},
+			size: doc.Size,
+			kind: documentMedia(doc, m).Type,
+		}
+		for _, attr := range doc.Attributes {
+			if a, ok := attr.(*tg.DocumentAttributeFilename); ok {
+				file.name = filepath.Base(a.FileName)
+				file.ext = filepath.Ext(a.FileName)
+			}
+		}
+		if file.ext == "" {
+			if exts, err := mime.ExtensionsByType(doc.MimeType); err == nil && len(exts) > 0 {
+				file.ext = exts[0]
+			}
+		}
+		return file, true
+	}
+	return mediaFile{}, false
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/gotd/td/tg"
+)
+
+// Режимы вывода форматированного текста сообщения
+const (
+	RenderNone     = ""
+	RenderMarkdown = "markdown"
+	RenderHTML     = "html"
+	RenderPlain    = "plain"
+)
+
+// extractEntities преобразует сущности Telegram в MessageEntity
+func extractEntities(entities []tg.MessageEntityClass) []MessageEntity {
+	result := make([]MessageEntity, 0, len(entities))
+	for _, entity := range entities {
+		info := MessageEntity{
+			Offset: entity.GetOffset(),
+			Length: entity.GetLength(),
+		}
+		switch e := entity.(type) {
+		case *tg.MessageEntityBold:
+			info.Type = "bold"
+		case *tg.MessageEntityItalic:
+			info.Type = "italic"
+		case *tg.MessageEntityUnderline:
+			info.Type = "underline"
+		case *tg.MessageEntityStrike:
+			info.Type = "strike"
+		case *tg.MessageEntitySpoiler:
+			info.Type = "spoiler"
+		case *tg.MessageEntityBlockquote:
+			info.Type = "blockquote"
+		case *tg.MessageEntityCode:
+			info.Type = "code"
+		case *tg.MessageEntityPre:
+			info.Type = "pre"
+			info.Language = e.Language
+		case *tg.MessageEntityURL:
+			info.Type = "url"
+		case *tg.MessageEntityTextURL:
+			info.Type = "text_url"
+			info.URL = e.URL
+		case *tg.MessageEntityMention:
+			info.Type = "mention"
+		case *tg.MessageEntityMentionName:
+			info.Type = "mention_name"
+			info.UserID = e.UserID
+		case *tg.InputMessageEntityMentionName:
+			// Встречается в сообщениях, собранных из отправленного нами текста
+			info.Type = "mention_name"
+			if user, ok := e.UserID.(*tg.InputUser); ok {
+				info.UserID = user.UserID
+			}
+		case *tg.MessageEntityHashtag:
+			info.Type = "hashtag"
+		case *tg.MessageEntityCashtag:
+			info.Type = "cashtag"
+		case *tg.MessageEntityBotCommand:
+			info.Type = "bot_command"
+		case *tg.MessageEntityEmail:
+			info.Type = "email"
+		case *tg.MessageEntityPhone:
+			info.Type = "phone"
+		case *tg.MessageEntityBankCard:
+			info.Type = "bank_card"
+		case *tg.MessageEntityCustomEmoji:
+			info.Type = "custom_emoji"
+			info.CustomEmojiID = e.DocumentID
+		default:
+			info.Type = "unknown"
+		}
+		result = append(result, info)
+	}
+	return result
+}
+
+// entityMarkup возвращает открывающую и закрывающую разметку сущности.
+//
+// Автоматически распознаваемые сущности (url, mention, hashtag и т.п.) не требуют
+// разметки: Telegram находит их в тексте сам.
+func entityMarkup(e MessageEntity, mode string) (string, string, bool) {
+	if mode == RenderHTML {
+		switch e.Type {
+		case "bold":
+			return "<b>", "</b>", true
+		case "italic":
+			return "<i>", "</i>", true
+		case "underline":
+			return "<u>", "</u>", true
+		case "strike":
+			return "<s>", "</s>", true
+		case "spoiler":
+			return "<tg-spoiler>", "</tg-spoiler>", true
+		case "blockquote":
+			return "<blockquote>", "</blockquote>", true
+		case "code":
+			return "<code>", "</code>", true
+		case "pre":
+			if e.Language != "" {
+				return `<pre><code class="language-` + html.EscapeString(e.Language) + `">`, "</code></pre>", true
+			}
+			return "<pre>", "</pre>", true
+		case "text_url":
+			return `<a href="` + html.EscapeString(e.URL) + `">`, "</a>", true
+		case "mention_name":
+			return `<a href="tg://user?id=` + strconv.FormatInt(e.UserID, 10) + `">`, "</a>", true
+		case "custom_emoji":
+			return `<tg-emoji emoji-id="` + strconv.FormatInt(e.CustomEmojiID, 10) + `">`, "</tg-emoji>", true
+		}
+		return "", "", false
+	}
+
+	// Markdown в синтаксисе, который понимает --parse-mode markdown
+	switch e.Type {
+	case "bold":
+		return "**", "**", true
+	case "italic":
+		return "_", "_", true
+	case "underline":
+		return "__", "__", true
+	case "strike":
+		return "~~", "~~", true
+	case "spoiler":
+		return "||", "||", true
+	case "blockquote":
+		return ">", "", true
+	case "code":
+		return "`", "`", true
+	case "pre":
+		return "```" + e.Language + "\n", "```", true
+	case "text_url":
+		return "[", "](" + e.URL + ")", true
+	case "mention_name":
+		return "[", "](tg://user?id=" + strconv.FormatInt(e.UserID, 10) + ")", true
+	case "custom_emoji":
+		return "![", "](tg://emoji?id=" + strconv.FormatInt(e.CustomEmojiID, 10) + ")", true
+	}
+	return "", "", false
+}
+
+// renderSpan описывает сущность с разметкой в границах текста
+type renderSpan struct {
+	entity      MessageEntity
+	open, close string
+	start, end  int
+}
+
+// renderText собирает размеченный текст из текста сообщения и его сущностей.
+//
+// Смещения сущностей заданы в кодовых единицах UTF-16, поэтому текст разбивается
+// на фрагменты именно по ним. Пересекающиеся сущности закрываются и открываются
+// заново, чтобы разметка оставалась корректно вложенной.
+func renderText(text string, entities []MessageEntity, mode string) (string, error) {
+	switch mode {
+	case RenderNone:
+		return "", nil
+	case RenderPlain:
+		return renderPlain(text, entities), nil
+	case RenderMarkdown, RenderHTML:
+	default:
+		return "", fmt.Errorf("unknown render mode %q: expected markdown, html or plain", mode)
+	}
+
+	units := utf16.Encode([]rune(text))
+
+	// Оставляем только сущности с разметкой, обрезанные по границам текста
+	var spans []renderSpan
+	for _, e := range entities {
+		open, closing, ok := entityMarkup(e, mode)
+		if !ok || e.Length <= 0 || e.Offset < 0 || e.Offset >= len(units) {
+			continue
+		}
+		end := e.Offset + e.Length
+		if end > len(units) {
+			end = len(units)
+		}
+		spans = append(spans, renderSpan{entity: e, open: open, close: closing, start: e.Offset, end: end})
+	}
+	// Цитата открывается первой, так как ее маркер должен стоять в начале строки
+	sort.SliceStable(spans, func(i, j int) bool {
+		a, b := spans[i], spans[j]
+		if a.start != b.start {
+			return a.start < b.start
+		}
+		if (a.entity.Type == "blockquote") != (b.entity.Type == "blockquote") {
+			return a.entity.Type == "blockquote"
+		}
+		return a.end > b.end
+	})
+
+	// Границы фрагментов текста
+	bounds := []int{0, len(units)}
+	for _, s := range spans {
+		bounds = append(bounds, s.start, s.end)
+	}
+	sort.Ints(bounds)
+	unique := bounds[:1]
+	for _, b := range bounds[1:] {
+		if b != unique[len(unique)-1] {
+			unique = append(unique, b)
+		}
+	}
+	bounds = unique
+
+	var out strings.Builder
+	var stack []int
+	next := 0
+	for i, pos := range bounds {
+		// Закрываем сущности, заканчивающиеся здесь, и переоткрываем перекрытые ими
+		var reopen []int
+		for endsAt(spans, stack, pos) {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			out.WriteString(spans[top].close)
+			if spans[top].end != pos {
+				reopen = append(reopen, top)
+			}
+		}
+		for j := len(reopen) - 1; j >= 0; j-- {
+			out.WriteString(spans[reopen[j]].open)
+			stack = append(stack, reopen[j])
+		}
+
+		// Открываем сущности, начинающиеся здесь
+		for ; next < len(spans) && spans[next].start == pos; next++ {
+			if mode == RenderMarkdown && spans[next].entity.Type == "italic" && endsWithWordChar(out.String()) {
+				// _ внутри слова не считается разметкой (snake_case), поэтому там курсив выводится через *
+				spans[next].open, spans[next].close = "*", "*"
+			}
+			out.WriteString(spans[next].open)
+			stack = append(stack, next)
+		}
+
+		if pos >= len(units) {
+			continue
+		}
+
+		// Выводим фрагмент текста до следующей границы
+		fragment := string(utf16.Decode(units[pos:bounds[i+1]]))
+		if mode == RenderHTML {
+			out.WriteString(html.EscapeString(fragment))
+			continue
+		}
+		raw, quoteEnd := false, 0
+		for _, k := range stack {
+			switch spans[k].entity.Type {
+			case "code", "pre":
+				raw = true
+			case "blockquote":
+				if spans[k].end > quoteEnd {
+					quoteEnd = spans[k].end
+				}
+			}
+		}
+		out.WriteString(escapeMarkdown(fragment, pos, raw, quoteEnd, pos == 0 || units[pos-1] == '\n'))
+	}
+	return out.String(), nil
+}
+
+// endsAt сообщает, заканчивается ли в позиции pos одна из открытых сущностей
+func endsAt(spans []renderSpan, stack []int, pos int) bool {
+	for _, k := range stack {
+		if spans[k].end == pos {
+			return true
+		}
+	}
+	return false
+}
+
+// endsWithWordChar сообщает, заканчивается ли строка буквой или цифрой
+func endsWithWordChar(s string) bool {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// escapeMarkdown экранирует служебные символы Markdown во фрагменте текста.
+//
+// Внутри кода текст выводится как есть. Внутри цитаты каждая следующая строка
+// начинается с маркера >, пока цитата не закончилась (offset и quoteEnd в UTF-16).
+func escapeMarkdown(s string, offset int, raw bool, quoteEnd int, lineStart bool) string {
+	var b strings.Builder
+	for _, r := range s {
+		if !raw {
+			switch r {
+			case '\\', '*', '_', '~', '|', '`', '[', ']':
+				b.WriteByte('\\')
+			case '>':
+				// Маркер цитаты распознается только в начале строки
+				if lineStart {
+					b.WriteByte('\\')
+				}
+			}
+		}
+		b.WriteRune(r)
+
+		offset += utf16Len(string(r))
+		lineStart = r == '\n'
+		if lineStart && offset < quoteEnd {
+			b.WriteByte('>')
+		}
+	}
+	return b.String()
+}
+
+// renderPlain возвращает текст без разметки, дописывая адреса скрытых ссылок
+func renderPlain(text string, entities []MessageEntity) string {
+	units := utf16.Encode([]rune(text))
+
+	var links []MessageEntity
+	for _, e := range entities {
+		if e.Type == "text_url" && e.URL != "" && e.Offset+e.Length <= len(units) && e.Length > 0 {
+			links = append(links, e)
+		}
+	}
+	if len(links) == 0 {
+		return text
+	}
+	sort.SliceStable(links, func(i, j int) bool {
+		return links[i].Offset+links[i].Length < links[j].Offset+links[j].Length
+	})
+
+	var out strings.Builder
+	pos := 0
+	for _, link := range links {
+		end := link.Offset + link.Length
+		out.WriteString(string(utf16.Decode(units[pos:end])))
+		out.WriteString(" (" + link.URL + ")")
+		pos = end
+	}
+	out.WriteString(string(utf16.Decode(units[pos:])))
+	return out.String()
+}
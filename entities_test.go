@@ -0,0 +1,167 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Разметка в каноническом виде после разбора и обратной сборки не меняется,
+// а повторный разбор дает те же текст и сущности
+func TestRenderTextRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		mode  string
+		input string
+	}{
+		{"markdown nested", RenderMarkdown, "a **b _c_ d** e"},
+		{"markdown surrogate pairs", RenderMarkdown, "😀 **😀x** [👍🏽 link](https://e.x) ![🙂](tg://emoji?id=5)"},
+		{"markdown nested underline", RenderMarkdown, "**bold __under__**"},
+		{"markdown mention and spoiler", RenderMarkdown, "[Bob](tg://user?id=42) ||👨‍👩‍👧|| ~~s~~ `c*d`"},
+		{"markdown italic inside a word", RenderMarkdown, "x*y*z"},
+		{"markdown escapes", RenderMarkdown, `a\*b snake\_case \[x\]`},
+		{"markdown blockquote", RenderMarkdown, ">quote 😀\n>**line** 2\nafter"},
+		{"markdown code block", RenderMarkdown, "```go\nfmt.Println(\"*😀*\")\n```"},
+		{"markdown emoji inside styles", RenderMarkdown, "_😀_**👍🏽**~~👨‍👩‍👧~~"},
+		{"html nested", RenderHTML, `😀 <b>bold <i>😀 both</i></b> <a href="https://e.x?a=1&amp;b=2">link 👍🏽</a>`},
+		{"html escapes and code", RenderHTML, `<tg-spoiler>s</tg-spoiler> &lt;tag&gt; <code>a&lt;b</code>`},
+		{"html pre with language", RenderHTML, `<pre><code class="language-go">x := 1 // 😀</code></pre>`},
+		{"html mention", RenderHTML, `<a href="tg://user?id=42">Bob</a> <u>u</u><s>s</s>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities, err := parseFormattedText(tt.input, tt.mode)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			parsed := extractEntities(entities)
+
+			rendered, err := renderText(text, parsed, tt.mode)
+			if err != nil {
+				t.Fatalf("renderText: %v", err)
+			}
+			if rendered != tt.input {
+				t.Errorf("renderText = %q, want %q", rendered, tt.input)
+			}
+
+			text2, entities2, err := parseFormattedText(rendered, tt.mode)
+			if err != nil {
+				t.Fatalf("parse rendered: %v", err)
+			}
+			if text2 != text {
+				t.Errorf("text after round trip = %q, want %q", text2, text)
+			}
+			if got := extractEntities(entities2); !reflect.DeepEqual(got, parsed) {
+				t.Errorf("entities after round trip = %+v, want %+v", got, parsed)
+			}
+		})
+	}
+}
+
+func TestRenderText(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		entities []MessageEntity
+		mode     string
+		want     string
+	}{
+		{
+			name:     "overlapping entities are split",
+			text:     "ab cd ef",
+			entities: []MessageEntity{{Type: "bold", Offset: 0, Length: 5}, {Type: "italic", Offset: 3, Length: 5}},
+			mode:     RenderHTML,
+			want:     "<b>ab <i>cd</i></b><i> ef</i>",
+		},
+		{
+			name:     "overlapping entities in markdown",
+			text:     "ab cd ef",
+			entities: []MessageEntity{{Type: "bold", Offset: 0, Length: 5}, {Type: "italic", Offset: 3, Length: 5}},
+			mode:     RenderMarkdown,
+			want:     "**ab _cd_**_ ef_",
+		},
+		{
+			name:     "offsets count surrogate pairs",
+			text:     "😀😀 a*_b",
+			entities: []MessageEntity{{Type: "bold", Offset: 2, Length: 2}, {Type: "code", Offset: 5, Length: 3}},
+			mode:     RenderMarkdown,
+			want:     "😀**😀** `a*_`b",
+		},
+		{
+			name:     "html escapes text inside entities",
+			text:     "😀😀 a*_b",
+			entities: []MessageEntity{{Type: "bold", Offset: 2, Length: 2}, {Type: "code", Offset: 5, Length: 3}},
+			mode:     RenderHTML,
+			want:     "😀<b>😀</b> <code>a*_</code>b",
+		},
+		{
+			name: "blockquote and custom emoji",
+			text: "a>b\nc>d 🙂",
+			entities: []MessageEntity{
+				{Type: "blockquote", Offset: 0, Length: 7},
+				{Type: "custom_emoji", Offset: 8, Length: 2, CustomEmojiID: 5},
+			},
+			mode: RenderMarkdown,
+			want: ">a>b\n>c>d ![🙂](tg://emoji?id=5)",
+		},
+		{
+			name: "blockquote and custom emoji in html",
+			text: "a>b\nc>d 🙂",
+			entities: []MessageEntity{
+				{Type: "blockquote", Offset: 0, Length: 7},
+				{Type: "custom_emoji", Offset: 8, Length: 2, CustomEmojiID: 5},
+			},
+			mode: RenderHTML,
+			want: "<blockquote>a&gt;b\nc&gt;d</blockquote> <tg-emoji emoji-id=\"5\">🙂</tg-emoji>",
+		},
+		{
+			name:     "entity past the end is clipped",
+			text:     "ab😀",
+			entities: []MessageEntity{{Type: "bold", Offset: 2, Length: 50}, {Type: "italic", Offset: 10, Length: 1}},
+			mode:     RenderHTML,
+			want:     "ab<b>😀</b>",
+		},
+		{
+			name:     "entities without markup are left as text",
+			text:     "@bob #tag https://e.x",
+			entities: []MessageEntity{{Type: "mention", Offset: 0, Length: 4}, {Type: "hashtag", Offset: 5, Length: 4}, {Type: "url", Offset: 10, Length: 11}},
+			mode:     RenderMarkdown,
+			want:     "@bob #tag https://e.x",
+		},
+		{
+			name: "plain appends hidden links",
+			text: "see docs 👍 now",
+			entities: []MessageEntity{
+				{Type: "text_url", Offset: 4, Length: 4, URL: "https://d"},
+				{Type: "text_url", Offset: 9, Length: 2, URL: "https://t"},
+			},
+			mode: RenderPlain,
+			want: "see docs (https://d) 👍 (https://t) now",
+		},
+		{
+			name:     "none renders nothing",
+			text:     "text",
+			entities: []MessageEntity{{Type: "bold", Offset: 0, Length: 4}},
+			mode:     RenderNone,
+			want:     "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderText(tt.text, tt.entities, tt.mode)
+			if err != nil {
+				t.Fatalf("renderText: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("renderText = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderTextUnknownMode(t *testing.T) {
+	if _, err := renderText("x", nil, "bbcode"); err == nil {
+		t.Error("expected error for unknown render mode")
+	}
+}
@@ -3,11 +3,16 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gotd/td/telegram"
-	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/telegram/updates"
+	updhook "github.com/gotd/td/telegram/updates/hook"
 	"github.com/gotd/td/tg"
 )
 
@@ -22,472 +27,457 @@ const (
 	EventUserStatus EventType = "user_status" // Изменение статуса пользователя
 	EventTyping     EventType = "typing"      // Печатает сообщение
 	EventChatAction EventType = "chat_action" // Действие в чате (добавление/удаление участников)
+
+	// Сервер не отдал пропущенные обновления канала: часть событий потеряна,
+	// и историю чата нужно перечитать командой messages
+	EventChannelTooLong EventType = "channel_too_long"
 )
 
 // EventInfo содержит информацию о событии
 type EventInfo struct {
-	Type      EventType       `json:"type"`
-	Time      int64           `json:"time"` // Unix timestamp
-	ChatID    int64           `json:"chat_id,omitempty"`
-	ChatType  string          `json:"chat_type,omitempty"`
-	ChatTitle string          `json:"chat_title,omitempty"`
-	UserID    int64           `json:"user_id,omitempty"`
-	Username  string          `json:"username,omitempty"`
-	FirstName string          `json:"first_name,omitempty"`
-	LastName  string          `json:"last_name,omitempty"`
-	MessageID int             `json:"message_id,omitempty"`
-	Message   string          `json:"message,omitempty"`
-	Action    string          `json:"action,omitempty"`
-	RawData   json.RawMessage `json:"raw_data,omitempty"`
+	Type       EventType       `json:"type"`
+	Time       int64           `json:"time"` // Unix timestamp
+	ChatID     int64           `json:"chat_id,omitempty"`
+	ChatType   string          `json:"chat_type,omitempty"`
+	ChatTitle  string          `json:"chat_title,omitempty"`
+	UserID     int64           `json:"user_id,omitempty"`
+	Username   string          `json:"username,omitempty"`
+	FirstName  string          `json:"first_name,omitempty"`
+	LastName   string          `json:"last_name,omitempty"`
+	MessageID  int             `json:"message_id,omitempty"`
+	TopicID    int             `json:"topic_id,omitempty"`
+	Message    string          `json:"message,omitempty"`
+	Action     string          `json:"action,omitempty"`
+	RawData    json.RawMessage `json:"raw_data,omitempty"`
+	Details    *MessageInfo    `json:"message_info,omitempty"` // Сообщение в том же виде, что и в команде messages
+	ChatAction *ChatActionInfo `json:"chat_action,omitempty"`
+	Read       *ReadEventInfo  `json:"read,omitempty"`
+}
+
+// EventsOptions задает параметры отслеживания событий
+type EventsOptions struct {
+	Timeout   int    // Таймаут в секундах; 0 означает бесконечное отслеживание
+	StateFile string // Файл состояния обновлений для продолжения после перезапуска
+	Fresh     bool   // Начать с текущего состояния, пропустив накопленные обновления
+	Filter    EventFilterOptions
+	Sink      SinkOptions
+
+	// Не запрашивать код входа: без действующей сессии вернуть errSessionRevoked.
+	// Демон работает без терминала, поэтому интерактивный вход ему недоступен
+	RequireSession bool
+
+	// Адрес HTTP-сервера метрик Prometheus; пустой отключает сервер.
+	// Сервер запускается в runEvents и runDaemon и переживает переподключения
+	MetricsAddr string
+}
+
+// errSinkFailed завершает отслеживание, если приемник не смог принять событие
+var errSinkFailed = errors.New("event delivery failed")
+
+// maxPendingEvents сколько событий, пришедших до готовности фильтра и приемника, держать в памяти
+const maxPendingEvents = 10000
+
+// eventStream превращает обновления в события и выводит те, что прошли фильтр.
+// Фильтр и приемник создаются после авторизации, а менеджер обновлений до
+// gaps.Run передает обновления обработчикам напрямую, поэтому ранние события
+// откладываются в pending и доставляются в start
+type eventStream struct {
+	peers *peerCache
+
+	mux     sync.Mutex
+	ready   bool         // После start filter и sink не меняются и читаются без блокировки
+	pending []EventInfo  // События, пришедшие до start
+	filter  *eventFilter // Задается в start
+	sink    EventSink    // Задается в start
+
+	failed atomic.Bool // Приемник вернул ошибку: дальнейшие события не доставляются
+	fail   func(error) // Останавливает отслеживание, не сохраняя состояние дальше
 }
 
 // GetEvents запускает отслеживание событий Telegram
-func GetEvents(ctx context.Context, config AuthConfig, timeout int) error {
+func GetEvents(ctx context.Context, config AuthConfig, opts EventsOptions) error {
 	// Создаем контекст с таймаутом, если указан
 	var cancel context.CancelFunc
-	if timeout > 0 {
-		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	if opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(opts.Timeout)*time.Second)
 		defer cancel()
 	}
 
-	// Создаем клиент
-	client := telegram.NewClient(config.AppID, config.AppHash, telegram.Options{
-		SessionStorage: &telegram.FileSessionStorage{
-			Path: config.SessionFile,
+	// Сохраненное состояние позволяет догнать обновления, пришедшие пока процесс не работал
+	storage, err := openFileStateStorage(opts.StateFile)
+	if err != nil {
+		return err
+	}
+	// Записываем отложенное состояние последним, когда приемник уже закрыт
+	defer func() {
+		if err := storage.close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}()
+
+	// Ошибка приемника останавливает отслеживание, а состояние не сдвигается
+	// дальше недоставленного события: после перезапуска оно придет снова
+	ctx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+
+	// Диспетчер раскладывает обновления по обработчикам событий
+	dispatcher := tg.NewUpdateDispatcher()
+	stream := &eventStream{
+		peers: newPeerCache(),
+		fail: func(err error) {
+			storage.freeze()
+			stop(fmt.Errorf("%w: %v", errSinkFailed, err))
+		},
+	}
+	defer stream.close()
+	registerEventHandlers(dispatcher, stream)
+
+	// Менеджер обновлений следит за pts/qts/seq, при пропусках запрашивает
+	// getDifference (для каналов getChannelDifference) и передает обновления диспетчеру
+	gaps := updates.New(updates.Config{
+		Handler:      dispatcher,
+		Storage:      storage,
+		AccessHasher: storage,
+		OnChannelTooLong: func(channelID int64) {
+			fmt.Fprintf(os.Stderr, "Warning: too many missed updates in channel %d, some events were skipped\n", channelID)
+			stream.handleChannelTooLong(ctx, channelID)
 		},
 	})
 
-	// Запускаем клиент
-	return client.Run(ctx, func(ctx context.Context) error {
-		// Авторизируемся при необходимости
-		flow := auth.NewFlow(
-			auth.CodeOnly(config.Phone, &telegramCodeAuth{}),
-			auth.SendCodeOptions{},
-		)
-
-		// Выполняем авторизацию если нужно
-		fmt.Println("Checking authorization...")
-		if err := client.Auth().IfNecessary(ctx, flow); err != nil {
-			return fmt.Errorf("authentication error: %w", err)
-		}
-
-		// Проверяем авторизацию
-		status, err := client.Auth().Status(ctx)
-		if err != nil {
-			return fmt.Errorf("failed to get auth status: %w", err)
-		}
-
-		if !status.Authorized {
-			return fmt.Errorf("not authorized")
-		}
-
-		fmt.Println("Starting events tracking...")
-
-		// Получаем API клиент
-		api := client.API()
-
-		// Создаем обработчик обновлений
-		dispatcher := tg.NewUpdateDispatcher()
-
-		// Обработчик новых сообщений
-		dispatcher.OnNewMessage(func(ctx context.Context, entities tg.Entities, update *tg.UpdateNewMessage) error {
-			return handleNewMessage(entities, update)
-		})
-
-		// Обработчик редактирования сообщений
-		dispatcher.OnEditMessage(func(ctx context.Context, entities tg.Entities, update *tg.UpdateEditMessage) error {
-			return handleEditMessage(entities, update)
-		})
+	// Обновления приходят как push-сообщениями сервера, так и в ответах на наши запросы
+	client := newClient(config, telegram.Options{
+		UpdateHandler: gaps,
+		Middlewares: []telegram.Middleware{
+			metricsMiddleware(),
+			updhook.UpdateHook(gaps.Handle),
+		},
+	})
 
-		// Создаем канал для получения обновлений
-		updates := make(chan tg.UpdatesClass, 100)
-
-		// Запускаем горутину для обработки обновлений
-		go func() {
-			for update := range updates {
-				// Обрабатываем различные типы обновлений
-				switch u := update.(type) {
-				case *tg.Updates:
-					for _, update := range u.Updates {
-						handleUpdate(update)
-					}
-				case *tg.UpdatesCombined:
-					for _, update := range u.Updates {
-						handleUpdate(update)
-					}
-				case *tg.UpdateShort:
-					handleUpdate(u.Update)
-				}
+	err = client.Run(ctx, func(ctx context.Context) error {
+		if opts.RequireSession {
+			status, err := client.Auth().Status(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to get auth status: %w", err)
 			}
-		}()
-
-		// Получаем текущее состояние
-		state, err := api.UpdatesGetState(ctx)
-		if err != nil {
-			return fmt.Errorf("failed to get updates state: %w", err)
+			if !status.Authorized {
+				return errSessionRevoked
+			}
+		} else if err := authorize(ctx, client, config); err != nil {
+			return err
 		}
 
-		// Получаем разницу в обновлениях
-		diff, err := api.UpdatesGetDifference(ctx, &tg.UpdatesGetDifferenceRequest{
-			Pts:  state.Pts,
-			Date: state.Date,
-			Qts:  state.Qts,
-		})
+		self, err := client.Self(ctx)
 		if err != nil {
-			return fmt.Errorf("failed to get updates difference: %w", err)
+			return fmt.Errorf("failed to get current user: %w", err)
 		}
 
-		// Обрабатываем полученные обновления
-		switch d := diff.(type) {
-		case *tg.UpdatesDifference:
-			for _, update := range d.NewMessages {
-				handleMessage(update)
-			}
-			for _, update := range d.OtherUpdates {
-				handleUpdate(update)
-			}
-		case *tg.UpdatesDifferenceSlice:
-			for _, update := range d.NewMessages {
-				handleMessage(update)
-			}
-			for _, update := range d.OtherUpdates {
-				handleUpdate(update)
-			}
+		// Фильтр может ссылаться на чаты по @username, поэтому собирается после авторизации
+		filter, err := newEventFilter(ctx, client, opts.Filter)
+		if err != nil {
+			return err
 		}
 
-		// Запускаем цикл получения обновлений
-		for {
-			select {
-			case <-ctx.Done():
-				close(updates)
-				return ctx.Err()
-			default:
-				// Получаем обновления
-				updateResp, err := api.UpdatesGetDifference(ctx, &tg.UpdatesGetDifferenceRequest{
-					Pts:  state.Pts,
-					Date: state.Date,
-					Qts:  state.Qts,
-				})
-				if err != nil {
-					fmt.Printf("Error getting updates: %v\n", err)
-					time.Sleep(5 * time.Second)
-					continue
-				}
-
-				// Обрабатываем полученные обновления
-				switch d := updateResp.(type) {
-				case *tg.UpdatesDifference:
-					for _, update := range d.NewMessages {
-						handleMessage(update)
-					}
-					for _, update := range d.OtherUpdates {
-						handleUpdate(update)
-					}
-
-					// Обновляем состояние
-					state.Pts = d.State.Pts
-					state.Date = d.State.Date
-					state.Qts = d.State.Qts
-
-				case *tg.UpdatesDifferenceSlice:
-					for _, update := range d.NewMessages {
-						handleMessage(update)
-					}
-					for _, update := range d.OtherUpdates {
-						handleUpdate(update)
-					}
-
-					// Обновляем состояние
-					state.Pts = d.IntermediateState.Pts
-					state.Date = d.IntermediateState.Date
-					state.Qts = d.IntermediateState.Qts
-
-				case *tg.UpdatesDifferenceEmpty:
-					// Нет новых обновлений
-					state.Date = d.Date
-				}
-
-				// Небольшая пауза перед следующим запросом
-				time.Sleep(1 * time.Second)
-			}
+		// Шаблоны subject брокеров используют ID аккаунта. Ошибка проверяется до
+		// присваивания интерфейсу: типизированный nil сломал бы stream.close
+		sink, err := newEventSink(ctx, opts.Sink, self.ID)
+		if err != nil {
+			return err
 		}
+		stream.start(ctx, filter, sink)
+
+		return gaps.Run(ctx, client.API(), self.ID, updates.AuthOptions{
+			IsBot:  self.Bot,
+			Forget: opts.Fresh,
+			OnStart: func(ctx context.Context) {
+				fmt.Fprintln(os.Stderr, "Starting events tracking...")
+			},
+		})
 	})
-}
-
-// handleMessage обрабатывает сообщение
-func handleMessage(message tg.MessageClass) {
-	msg, ok := message.(*tg.Message)
-	if !ok {
-		return
-	}
-
-	// Создаем информацию о событии
-	event := EventInfo{
-		Type:      EventMessage,
-		Time:      time.Now().Unix(),
-		MessageID: msg.ID,
-		Message:   msg.Message,
-	}
 
-	// Определяем чат
-	if msg.PeerID != nil {
-		switch peer := msg.PeerID.(type) {
-		case *tg.PeerUser:
-			event.ChatID = peer.UserID
-			event.ChatType = "user"
-		case *tg.PeerChat:
-			event.ChatID = -peer.ChatID
-			event.ChatType = "chat"
-		case *tg.PeerChannel:
-			event.ChatID = -1000000000000 - peer.ChannelID
-			event.ChatType = "channel"
-		}
+	if cause := context.Cause(ctx); errors.Is(cause, errSinkFailed) {
+		return cause
 	}
 
-	// Определяем отправителя
-	if msg.FromID != nil {
-		if fromUser, ok := msg.FromID.(*tg.PeerUser); ok {
-			event.UserID = fromUser.UserID
-		}
+	// Остановка по таймауту или сигналу — штатное завершение
+	if err != nil && ctx.Err() != nil {
+		return nil
 	}
-
-	// Выводим событие в формате JSON
-	outputEvent(event)
+	return err
 }
 
-// handleUpdate обрабатывает обновление
-func handleUpdate(update tg.UpdateClass) {
-	switch u := update.(type) {
-	case *tg.UpdateNewMessage:
-		if msg, ok := u.Message.(*tg.Message); ok {
-			// Создаем информацию о событии
-			event := EventInfo{
-				Type:      EventMessage,
-				Time:      time.Now().Unix(),
-				MessageID: msg.ID,
-				Message:   msg.Message,
-			}
-
-			// Определяем чат
-			if msg.PeerID != nil {
-				switch peer := msg.PeerID.(type) {
-				case *tg.PeerUser:
-					event.ChatID = peer.UserID
-					event.ChatType = "user"
-				case *tg.PeerChat:
-					event.ChatID = -peer.ChatID
-					event.ChatType = "chat"
-				case *tg.PeerChannel:
-					event.ChatID = -1000000000000 - peer.ChannelID
-					event.ChatType = "channel"
-				}
-			}
-
-			// Определяем отправителя
-			if msg.FromID != nil {
-				if fromUser, ok := msg.FromID.(*tg.PeerUser); ok {
-					event.UserID = fromUser.UserID
-				}
-			}
-
-			// Выводим событие в формате JSON
-			outputEvent(event)
-		}
-
-	case *tg.UpdateEditMessage:
-		if msg, ok := u.Message.(*tg.Message); ok {
-			// Создаем информацию о событии
-			event := EventInfo{
-				Type:      EventEdit,
-				Time:      time.Now().Unix(),
-				MessageID: msg.ID,
-				Message:   msg.Message,
-			}
+// registerEventHandlers подключает к диспетчеру обработчики, превращающие обновления в события
+func registerEventHandlers(dispatcher tg.UpdateDispatcher, s *eventStream) {
+	// Новые сообщения
+	dispatcher.OnNewMessage(func(ctx context.Context, entities tg.Entities, update *tg.UpdateNewMessage) error {
+		return s.handleMessageEvent(ctx, EventMessage, update.Message, entities)
+	})
 
-			// Определяем чат
-			if msg.PeerID != nil {
-				switch peer := msg.PeerID.(type) {
-				case *tg.PeerUser:
-					event.ChatID = peer.UserID
-					event.ChatType = "user"
-				case *tg.PeerChat:
-					event.ChatID = -peer.ChatID
-					event.ChatType = "chat"
-				case *tg.PeerChannel:
-					event.ChatID = -1000000000000 - peer.ChannelID
-					event.ChatType = "channel"
-				}
-			}
+	// Редактирование сообщений
+	dispatcher.OnEditMessage(func(ctx context.Context, entities tg.Entities, update *tg.UpdateEditMessage) error {
+		return s.handleMessageEvent(ctx, EventEdit, update.Message, entities)
+	})
 
-			// Определяем отправителя
-			if msg.FromID != nil {
-				if fromUser, ok := msg.FromID.(*tg.PeerUser); ok {
-					event.UserID = fromUser.UserID
-				}
-			}
+	// Новые сообщения в супергруппах и каналах
+	dispatcher.OnNewChannelMessage(func(ctx context.Context, entities tg.Entities, update *tg.UpdateNewChannelMessage) error {
+		return s.handleMessageEvent(ctx, EventMessage, update.Message, entities)
+	})
 
-			// Выводим событие в формате JSON
-			outputEvent(event)
-		}
+	// Редактирование сообщений в супергруппах и каналах
+	dispatcher.OnEditChannelMessage(func(ctx context.Context, entities tg.Entities, update *tg.UpdateEditChannelMessage) error {
+		return s.handleMessageEvent(ctx, EventEdit, update.Message, entities)
+	})
 
-	case *tg.UpdateDeleteMessages:
-		// Создаем информацию о событии
-		event := EventInfo{
-			Type: EventDelete,
-			Time: time.Now().Unix(),
-		}
+	// Удаление сообщений в личных чатах и группах; сервер не сообщает, в каком чате они были
+	dispatcher.OnDeleteMessages(func(ctx context.Context, entities tg.Entities, update *tg.UpdateDeleteMessages) error {
+		return s.handleDeleteEvent(ctx, nil, update.Messages, entities)
+	})
 
-		// Сериализуем ID удаленных сообщений
-		messageIDs, _ := json.Marshal(u.Messages)
-		event.RawData = messageIDs
+	// Удаление сообщений в супергруппах и каналах
+	dispatcher.OnDeleteChannelMessages(func(ctx context.Context, entities tg.Entities, update *tg.UpdateDeleteChannelMessages) error {
+		return s.handleDeleteEvent(ctx, &tg.PeerChannel{ChannelID: update.ChannelID}, update.Messages, entities)
+	})
 
-		// Выводим событие в формате JSON
-		outputEvent(event)
+	// Изменения участников и прочтения
+	registerChatActionHandlers(dispatcher, s)
 
-	case *tg.UpdateUserStatus:
-		// Создаем информацию о событии
+	// Изменение статуса пользователя
+	dispatcher.OnUserStatus(func(ctx context.Context, entities tg.Entities, update *tg.UpdateUserStatus) error {
 		event := EventInfo{
 			Type:   EventUserStatus,
 			Time:   time.Now().Unix(),
-			UserID: u.UserID,
-		}
-
-		// Определяем статус
-		switch status := u.Status.(type) {
-		case *tg.UserStatusOnline:
-			event.Action = "online"
-		case *tg.UserStatusOffline:
-			event.Action = "offline"
-		case *tg.UserStatusRecently:
-			event.Action = "recently"
-		case *tg.UserStatusLastWeek:
-			event.Action = "last_week"
-		case *tg.UserStatusLastMonth:
-			event.Action = "last_month"
-		default:
-			event.Action = fmt.Sprintf("unknown_status_%T", status)
+			Action: userStatusName(update.Status),
 		}
+		s.peers.lookup(entities, func(userMap map[int64]tg.UserClass, chatMap map[int64]tg.ChatClass) {
+			fillEventUser(&event, update.UserID, userMap)
+		})
+		return s.emit(ctx, event)
+	})
 
-		// Выводим событие в формате JSON
-		outputEvent(event)
-
-	case *tg.UpdateUserTyping:
-		// Создаем информацию о событии
+	// Набор текста в личном чате
+	dispatcher.OnUserTyping(func(ctx context.Context, entities tg.Entities, update *tg.UpdateUserTyping) error {
 		event := EventInfo{
 			Type:   EventTyping,
 			Time:   time.Now().Unix(),
-			UserID: u.UserID,
-		}
-
-		// Определяем действие
-		switch action := u.Action.(type) {
-		case *tg.SendMessageTypingAction:
-			event.Action = "typing"
-		case *tg.SendMessageRecordVideoAction:
-			event.Action = "recording_video"
-		case *tg.SendMessageUploadVideoAction:
-			event.Action = "uploading_video"
-		case *tg.SendMessageRecordAudioAction:
-			event.Action = "recording_audio"
-		case *tg.SendMessageUploadAudioAction:
-			event.Action = "uploading_audio"
-		case *tg.SendMessageUploadPhotoAction:
-			event.Action = "uploading_photo"
-		case *tg.SendMessageUploadDocumentAction:
-			event.Action = "uploading_document"
-		case *tg.SendMessageGeoLocationAction:
-			event.Action = "choosing_location"
-		case *tg.SendMessageChooseContactAction:
-			event.Action = "choosing_contact"
-		default:
-			event.Action = fmt.Sprintf("unknown_action_%T", action)
+			Action: typingActionName(update.Action),
 		}
+		s.peers.lookup(entities, func(userMap map[int64]tg.UserClass, chatMap map[int64]tg.ChatClass) {
+			fillEventChat(&event, &tg.PeerUser{UserID: update.UserID}, userMap, chatMap)
+			fillEventUser(&event, update.UserID, userMap)
+		})
+		return s.emit(ctx, event)
+	})
+}
 
-		// Выводим событие в формате JSON
-		outputEvent(event)
+// handleMessageEvent выводит событие о новом или измененном сообщении
+func (s *eventStream) handleMessageEvent(ctx context.Context, eventType EventType, message tg.MessageClass, entities tg.Entities) error {
+	// Служебные сообщения (вступления, исключения, смена названия) выводятся как действия в чате
+	if service, ok := message.(*tg.MessageService); ok && eventType == EventMessage {
+		return s.handleServiceEvent(ctx, service, entities)
 	}
-}
 
-// Обработчик новых сообщений
-func handleNewMessage(entities tg.Entities, update *tg.UpdateNewMessage) error {
-	// Получаем сообщение
-	msg, ok := update.Message.(*tg.Message)
+	msg, ok := message.(*tg.Message)
 	if !ok {
 		return nil // Пропускаем, если это не сообщение
 	}
 
 	// Создаем информацию о событии
 	event := EventInfo{
-		Type:      EventMessage,
+		Type:      eventType,
 		Time:      time.Now().Unix(),
 		MessageID: msg.ID,
+		TopicID:   messageTopicID(msg),
 		Message:   msg.Message,
 	}
 
-	// Определяем чат
-	switch peer := msg.PeerID.(type) {
-	case *tg.PeerUser:
-		event.ChatID = peer.UserID
-		event.ChatType = "user"
-		// Имя пользователя можно получить из entities, если доступно
-	case *tg.PeerChat:
-		event.ChatID = -peer.ChatID // Используем отрицательный ID для групповых чатов
-		event.ChatType = "chat"
-	case *tg.PeerChannel:
-		event.ChatID = -1000000000000 - peer.ChannelID // Используем формат -100XXXXXXXXXX для каналов
-		event.ChatType = "channel"
-	}
+	// Сообщение собирается тем же кодом, что и для команды messages
+	s.peers.lookup(entities, func(userMap map[int64]tg.UserClass, chatMap map[int64]tg.ChatClass) {
+		fillEventChat(&event, msg.PeerID, userMap, chatMap)
+		if info, ok := extractMessage(msg, userMap, chatMap); ok {
+			event.Details = &info
+		}
 
-	// Определяем отправителя
-	if msg.FromID != nil {
+		// Определяем отправителя
 		if fromUser, ok := msg.FromID.(*tg.PeerUser); ok {
-			event.UserID = fromUser.UserID
-			// Имя отправителя можно получить из entities, если доступно
+			fillEventUser(&event, fromUser.UserID, userMap)
 		}
-	}
+	})
 
 	// Выводим событие в формате JSON
-	return outputEvent(event)
+	return s.emit(ctx, event)
 }
 
-// Обработчик редактирования сообщений
-func handleEditMessage(entities tg.Entities, update *tg.UpdateEditMessage) error {
-	// Получаем сообщение
-	msg, ok := update.Message.(*tg.Message)
-	if !ok {
-		return nil // Пропускаем, если это не сообщение
+// handleDeleteEvent выводит событие об удалении сообщений; peer известен только для каналов
+func (s *eventStream) handleDeleteEvent(ctx context.Context, peer tg.PeerClass, messages []int, entities tg.Entities) error {
+	event := EventInfo{
+		Type: EventDelete,
+		Time: time.Now().Unix(),
+	}
+	if peer != nil {
+		s.peers.lookup(entities, func(userMap map[int64]tg.UserClass, chatMap map[int64]tg.ChatClass) {
+			fillEventChat(&event, peer, userMap, chatMap)
+		})
 	}
 
-	// Создаем информацию о событии
+	// Сериализуем ID удаленных сообщений
+	messageIDs, _ := json.Marshal(messages)
+	event.RawData = messageIDs
+
+	return s.emit(ctx, event)
+}
+
+// handleChannelTooLong сообщает потребителю о потерянных событиях канала,
+// чтобы он мог перечитать историю чата
+func (s *eventStream) handleChannelTooLong(ctx context.Context, channelID int64) error {
 	event := EventInfo{
-		Type:      EventEdit,
-		Time:      time.Now().Unix(),
-		MessageID: msg.ID,
-		Message:   msg.Message,
+		Type: EventChannelTooLong,
+		Time: time.Now().Unix(),
 	}
+	s.peers.lookup(tg.Entities{}, func(userMap map[int64]tg.UserClass, chatMap map[int64]tg.ChatClass) {
+		fillEventChat(&event, &tg.PeerChannel{ChannelID: channelID}, userMap, chatMap)
+	})
+	return s.emit(ctx, event)
+}
+
+// fillEventChat заполняет ID, тип и название чата события
+func fillEventChat(event *EventInfo, peer tg.PeerClass, userMap map[int64]tg.UserClass, chatMap map[int64]tg.ChatClass) {
+	event.ChatID = peerToChatID(peer)
+	event.ChatType = peerChatType(peer, chatMap)
+	event.ChatTitle = peerTitle(peer, userMap, chatMap)
+}
+
+// fillEventUser заполняет ID и имя пользователя события
+func fillEventUser(event *EventInfo, userID int64, userMap map[int64]tg.UserClass) {
+	event.UserID = userID
+	if user, ok := userMap[userID].(*tg.User); ok {
+		event.Username = user.Username
+		event.FirstName = user.FirstName
+		event.LastName = user.LastName
+	}
+}
 
-	// Определяем чат
-	switch peer := msg.PeerID.(type) {
+// peerChatType возвращает тип чата по Peer; супергруппы отличаются от каналов по данным кэша
+func peerChatType(peer tg.PeerClass, chatMap map[int64]tg.ChatClass) string {
+	switch p := peer.(type) {
 	case *tg.PeerUser:
-		event.ChatID = peer.UserID
-		event.ChatType = "user"
+		return "user"
 	case *tg.PeerChat:
-		event.ChatID = -peer.ChatID
-		event.ChatType = "chat"
+		return "chat"
 	case *tg.PeerChannel:
-		event.ChatID = -1000000000000 - peer.ChannelID
-		event.ChatType = "channel"
+		if channel, ok := chatMap[p.ChannelID].(*tg.Channel); ok && channel.Megagroup {
+			return "supergroup"
+		}
+		return "channel"
 	}
+	return ""
+}
 
-	// Определяем отправителя
-	if msg.FromID != nil {
-		if fromUser, ok := msg.FromID.(*tg.PeerUser); ok {
-			event.UserID = fromUser.UserID
+// userStatusName возвращает название статуса пользователя
+func userStatusName(status tg.UserStatusClass) string {
+	switch status.(type) {
+	case *tg.UserStatusOnline:
+		return "online"
+	case *tg.UserStatusOffline:
+		return "offline"
+	case *tg.UserStatusRecently:
+		return "recently"
+	case *tg.UserStatusLastWeek:
+		return "last_week"
+	case *tg.UserStatusLastMonth:
+		return "last_month"
+	}
+	return fmt.Sprintf("unknown_status_%T", status)
+}
+
+// typingActionName возвращает название действия набора
+func typingActionName(action tg.SendMessageActionClass) string {
+	switch action.(type) {
+	case *tg.SendMessageTypingAction:
+		return "typing"
+	case *tg.SendMessageRecordVideoAction:
+		return "recording_video"
+	case *tg.SendMessageUploadVideoAction:
+		return "uploading_video"
+	case *tg.SendMessageRecordAudioAction:
+		return "recording_audio"
+	case *tg.SendMessageUploadAudioAction:
+		return "uploading_audio"
+	case *tg.SendMessageUploadPhotoAction:
+		return "uploading_photo"
+	case *tg.SendMessageUploadDocumentAction:
+		return "uploading_document"
+	case *tg.SendMessageGeoLocationAction:
+		return "choosing_location"
+	case *tg.SendMessageChooseContactAction:
+		return "choosing_contact"
+	}
+	return fmt.Sprintf("unknown_action_%T", action)
+}
+
+// emit передает событие приемнику, если оно проходит фильтр; до start событие откладывается
+func (s *eventStream) emit(ctx context.Context, event EventInfo) error {
+	observeEvent(&event)
+
+	s.mux.Lock()
+	if !s.ready {
+		if len(s.pending) < maxPendingEvents {
+			s.pending = append(s.pending, event)
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: %s event dropped: too many events before tracking started\n", event.Type)
 		}
+		s.mux.Unlock()
+		return nil
 	}
+	s.mux.Unlock()
 
-	// Выводим событие в формате JSON
-	return outputEvent(event)
+	return s.deliver(ctx, event)
+}
+
+// start задает фильтр и приемник и доставляет отложенные события. Обработчики,
+// вызванные в это время, ждут блокировку, поэтому порядок событий сохраняется
+func (s *eventStream) start(ctx context.Context, filter *eventFilter, sink EventSink) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.filter, s.sink = filter, sink
+	for _, event := range s.pending {
+		s.deliver(ctx, event)
+	}
+	s.pending = nil
+	s.ready = true
+}
+
+// deliver применяет фильтр и отправляет событие приемнику. После первой ошибки
+// события больше не отправляются, чтобы не нарушить порядок при повторной доставке
+func (s *eventStream) deliver(ctx context.Context, event EventInfo) error {
+	if !s.filter.Match(&event) {
+		return nil
+	}
+	if s.failed.Load() {
+		return errSinkFailed
+	}
+	if err := s.sink.Send(ctx, event); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to deliver %s event: %v\n", event.Type, err)
+		if !s.failed.Swap(true) && s.fail != nil {
+			s.fail(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// close доставляет уже принятые события даже после отмены основного контекста
+func (s *eventStream) close() {
+	s.mux.Lock()
+	sink := s.sink
+	s.mux.Unlock()
+	if sink == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sinkDrainTimeout)
+	defer cancel()
+	if err := sink.Close(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
 }
 
 // outputEvent выводит событие в формате JSON
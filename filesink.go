@@ -0,0 +1,202 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileSinkOptions задает запись событий в NDJSON-файл с ротацией
+type FileSinkOptions struct {
+	Path     string        // Текущий файл; ротированные файлы создаются рядом с ним
+	MaxSize  int64         // Ротировать, когда файл превысит размер в байтах; 0 — без ограничения
+	MaxAge   time.Duration // Ротировать файл не реже этого интервала; 0 — без ограничения
+	Compress bool          // Сжимать ротированные файлы gzip
+}
+
+// fileSink дописывает события в файл по одному JSON на строку
+type fileSink struct {
+	opts     FileSinkOptions
+	mux      sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	compress sync.WaitGroup // Фоновое сжатие ротированных файлов
+}
+
+// newFileSink открывает файл на дозапись, создавая каталог при необходимости
+func newFileSink(opts FileSinkOptions) (*fileSink, error) {
+	if opts.Path == "" {
+		return nil, fmt.Errorf("file sink path is empty")
+	}
+	if err := os.MkdirAll(filepath.Dir(opts.Path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	f := &fileSink{opts: opts}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *fileSink) Send(ctx context.Context, event EventInfo) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to serialize event: %w", err)
+	}
+	line = append(line, '\n')
+
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	if f.needsRotation(int64(len(line))) {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := f.file.Write(line)
+	f.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+	// Приемник должен вернуть nil, только когда событие надежно сохранено:
+	// после этого состояние обновлений сдвигается дальше него
+	if err := f.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync log file: %w", err)
+	}
+	return nil
+}
+
+func (f *fileSink) Close(ctx context.Context) error {
+	f.mux.Lock()
+	err := f.file.Close()
+	f.mux.Unlock()
+
+	// Дожидаемся сжатия, чтобы не оставить недописанный .gz
+	done := make(chan struct{})
+	go func() {
+		f.compress.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("compression of rotated files interrupted: %w", ctx.Err())
+	}
+	return err
+}
+
+// open открывает текущий файл; уже существующий продолжается с его размером
+func (f *fileSink) open() error {
+	file, err := os.OpenFile(f.opts.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open events file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat events file: %w", err)
+	}
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = time.Now()
+	return nil
+}
+
+// needsRotation проверяет ограничения по размеру и возрасту; пустой файл не ротируется
+func (f *fileSink) needsRotation(next int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.opts.MaxSize > 0 && f.size+next > f.opts.MaxSize {
+		return true
+	}
+	return f.opts.MaxAge > 0 && time.Since(f.openedAt) >= f.opts.MaxAge
+}
+
+// rotate переименовывает текущий файл в events-20060102-150405.ndjson и открывает новый
+func (f *fileSink) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("failed to close events file: %w", err)
+	}
+
+	rotated := f.rotatedName(time.Now())
+	if err := os.Rename(f.opts.Path, rotated); err != nil {
+		return fmt.Errorf("failed to rotate events file: %w", err)
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	if f.opts.Compress {
+		f.compress.Add(1)
+		go func() {
+			defer f.compress.Done()
+			if err := gzipFile(rotated); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to compress %s: %v\n", rotated, err)
+			}
+		}()
+	}
+	return nil
+}
+
+// rotatedName добавляет к имени файла время ротации и, при совпадении, порядковый номер
+func (f *fileSink) rotatedName(now time.Time) string {
+	ext := filepath.Ext(f.opts.Path)
+	base := strings.TrimSuffix(f.opts.Path, ext) + "-" + now.Format("20060102-150405")
+
+	name := base + ext
+	for i := 1; fileExists(name) || fileExists(name+".gz"); i++ {
+		name = fmt.Sprintf("%s.%d%s", base, i, ext)
+	}
+	return name
+}
+
+// fileExists проверяет, существует ли файл
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// gzipFile сжимает файл в path.gz и удаляет исходный
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	zw.Name = filepath.Base(path)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
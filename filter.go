@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gotd/td/telegram"
+)
+
+// eventChatTypes допустимые значения --chat-types
+var eventChatTypes = []string{"user", "chat", "supergroup", "channel"}
+
+// EventFilterOptions задает отбор событий для команды events
+type EventFilterOptions struct {
+	Chats        []string    // Только эти чаты: ID или @username
+	ExcludeChats []string    // Кроме этих чатов
+	Types        []EventType // Только эти типы событий
+	From         []string    // Только от этих отправителей: ID или @username
+	Regex        string      // Текст сообщения должен совпадать с регулярным выражением
+	OnlyMentions bool        // Только сообщения с упоминанием аккаунта
+	OnlyIncoming bool        // Пропускать собственные исходящие сообщения
+	HasMedia     bool        // Только сообщения с медиа
+	ChatTypes    []string    // Только чаты этих типов: user, chat, supergroup, channel
+	Expr         string      // Выражение фильтра, объединяемое с остальными условиями через И
+}
+
+// eventFilter скомпилированный фильтр событий
+type eventFilter struct {
+	chats        map[int64]bool
+	excludeChats map[int64]bool
+	types        map[EventType]bool
+	from         map[int64]bool
+	chatTypes    map[string]bool
+	regex        *regexp.Regexp
+	opts         EventFilterOptions
+	expr         exprNode
+}
+
+// validate проверяет параметры фильтра, не требующие обращения к API
+func (o EventFilterOptions) validate() error {
+	for _, t := range o.Types {
+		switch t {
+		case EventMessage, EventEdit, EventDelete, EventRead, EventUserStatus, EventTyping, EventChatAction, EventChannelTooLong:
+		default:
+			return fmt.Errorf("unknown event type %q", t)
+		}
+	}
+	for _, t := range o.ChatTypes {
+		if !containsString(eventChatTypes, t) {
+			return fmt.Errorf("unknown chat type %q: expected one of %s", t, strings.Join(eventChatTypes, ", "))
+		}
+	}
+	if o.Regex != "" {
+		if _, err := regexp.Compile(o.Regex); err != nil {
+			return fmt.Errorf("invalid regex: %w", err)
+		}
+	}
+	if o.Expr != "" {
+		if _, err := compileFilterExpr(o.Expr); err != nil {
+			return fmt.Errorf("invalid filter expression: %w", err)
+		}
+	}
+	return nil
+}
+
+// newEventFilter компилирует фильтр; имена чатов и отправителей разрешаются через API
+func newEventFilter(ctx context.Context, client *telegram.Client, opts EventFilterOptions) (*eventFilter, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	f := &eventFilter{opts: opts}
+	var err error
+	if f.chats, err = resolveChatIDs(ctx, client, opts.Chats); err != nil {
+		return nil, err
+	}
+	if f.excludeChats, err = resolveChatIDs(ctx, client, opts.ExcludeChats); err != nil {
+		return nil, err
+	}
+	if f.from, err = resolveChatIDs(ctx, client, opts.From); err != nil {
+		return nil, err
+	}
+	if len(opts.Types) > 0 {
+		f.types = make(map[EventType]bool, len(opts.Types))
+		for _, t := range opts.Types {
+			f.types[t] = true
+		}
+	}
+	if len(opts.ChatTypes) > 0 {
+		f.chatTypes = make(map[string]bool, len(opts.ChatTypes))
+		for _, t := range opts.ChatTypes {
+			f.chatTypes[t] = true
+		}
+	}
+	if opts.Regex != "" {
+		f.regex = regexp.MustCompile(opts.Regex)
+	}
+	if opts.Expr != "" {
+		f.expr, _ = compileFilterExpr(opts.Expr)
+	}
+	return f, nil
+}
+
+// resolveChatIDs переводит список ID и @username в множество ID в формате Bot API
+func resolveChatIDs(ctx context.Context, client *telegram.Client, values []string) (map[int64]bool, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	ids := make(map[int64]bool, len(values))
+	for _, value := range values {
+		// Числовые ID не требуют поиска среди диалогов
+		if id, err := strconv.ParseInt(value, 10, 64); err == nil {
+			ids[id] = true
+			continue
+		}
+		_, id, err := resolvePeer(ctx, client, value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %q: %w", value, err)
+		}
+		ids[id] = true
+	}
+	return ids, nil
+}
+
+// Match сообщает, проходит ли событие все условия фильтра
+func (f *eventFilter) Match(event *EventInfo) bool {
+	if f.types != nil && !f.types[event.Type] {
+		return false
+	}
+	if f.chats != nil && !f.chats[event.ChatID] {
+		return false
+	}
+	if f.excludeChats[event.ChatID] {
+		return false
+	}
+	if f.chatTypes != nil && !f.chatTypes[event.ChatType] {
+		return false
+	}
+	// Среди потерянных событий могли быть подходящие под любые условия на содержимое
+	if event.Type == EventChannelTooLong {
+		return true
+	}
+	if f.from != nil && !f.from[eventSenderID(event)] {
+		return false
+	}
+	if f.regex != nil && !f.regex.MatchString(event.Message) {
+		return false
+	}
+
+	// Условия на содержимое требуют сообщения; собственные исходящие отсеиваются только среди сообщений
+	details := event.Details
+	if f.opts.OnlyMentions && (details == nil || !details.IsMentioned) {
+		return false
+	}
+	if f.opts.HasMedia && (details == nil || details.Media == nil) {
+		return false
+	}
+	if f.opts.OnlyIncoming && details != nil && details.IsOutgoing {
+		return false
+	}
+
+	return f.expr == nil || evalBool(f.expr, event)
+}
+
+// eventSenderID возвращает отправителя события: пользователя или канал, от имени которого написано сообщение
+func eventSenderID(event *EventInfo) int64 {
+	if event.UserID != 0 {
+		return event.UserID
+	}
+	if event.Details != nil && event.Details.SenderChat != nil {
+		return event.Details.SenderChat.ChatID
+	}
+	return 0
+}
+
+// containsString сообщает, есть ли строка в списке
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,613 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Небольшой язык выражений для --filter в духе CEL:
+//
+//	chat_type == "supergroup" && text.contains("urgent")
+//	type in ["message", "edit"] && !(user_id == 777000)
+//	text.lower().matches("deploy|rollback") || mentioned
+//
+// Поддерживаются литералы (строки, целые числа, true/false, списки), поля события,
+// операторы ! && || == != < <= > >= in и методы строк contains, startsWith,
+// endsWith, matches, lower. Типы проверяются при разборе выражения.
+
+// exprType тип значения выражения
+type exprType int
+
+const (
+	exprString exprType = iota
+	exprInt
+	exprBool
+	exprStringList
+	exprIntList
+)
+
+func (t exprType) String() string {
+	switch t {
+	case exprString:
+		return "string"
+	case exprInt:
+		return "int"
+	case exprBool:
+		return "bool"
+	case exprStringList:
+		return "list(string)"
+	case exprIntList:
+		return "list(int)"
+	}
+	return "unknown"
+}
+
+// exprField описывает поле события, доступное в выражении
+type exprField struct {
+	typ exprType
+	get func(event *EventInfo) any
+}
+
+// eventExprFields поля события, доступные в выражениях фильтра
+var eventExprFields = map[string]exprField{
+	"type":       {exprString, func(e *EventInfo) any { return string(e.Type) }},
+	"chat_id":    {exprInt, func(e *EventInfo) any { return e.ChatID }},
+	"chat_type":  {exprString, func(e *EventInfo) any { return e.ChatType }},
+	"chat_title": {exprString, func(e *EventInfo) any { return e.ChatTitle }},
+	"user_id":    {exprInt, func(e *EventInfo) any { return e.UserID }},
+	"username":   {exprString, func(e *EventInfo) any { return e.Username }},
+	"first_name": {exprString, func(e *EventInfo) any { return e.FirstName }},
+	"last_name":  {exprString, func(e *EventInfo) any { return e.LastName }},
+	"message_id": {exprInt, func(e *EventInfo) any { return int64(e.MessageID) }},
+	"topic_id":   {exprInt, func(e *EventInfo) any { return int64(e.TopicID) }},
+	"text":       {exprString, func(e *EventInfo) any { return e.Message }},
+	"action":     {exprString, func(e *EventInfo) any { return e.Action }},
+	"mentioned":  {exprBool, func(e *EventInfo) any { return e.Details != nil && e.Details.IsMentioned }},
+	"outgoing":   {exprBool, func(e *EventInfo) any { return e.Details != nil && e.Details.IsOutgoing }},
+	"has_media":  {exprBool, func(e *EventInfo) any { return e.Details != nil && e.Details.Media != nil }},
+	"forwarded":  {exprBool, func(e *EventInfo) any { return e.Details != nil && e.Details.Forward != nil }},
+	"media_type": {exprString, func(e *EventInfo) any {
+		if e.Details == nil {
+			return ""
+		}
+		return e.Details.MediaType
+	}},
+	"reply_to": {exprInt, func(e *EventInfo) any {
+		if e.Details == nil {
+			return int64(0)
+		}
+		return int64(e.Details.ReplyToMsgID)
+	}},
+}
+
+// exprNode узел разобранного выражения
+type exprNode interface {
+	typ() exprType
+	eval(event *EventInfo) any
+}
+
+// compileFilterExpr разбирает выражение фильтра; результат должен иметь тип bool
+func compileFilterExpr(source string) (exprNode, error) {
+	tokens, err := lexExpr(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+	}
+	if node.typ() != exprBool {
+		return nil, fmt.Errorf("filter expression must be bool, got %s", node.typ())
+	}
+	return node, nil
+}
+
+// Лексер
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokInt
+	tokOp
+)
+
+type exprToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// lexExpr разбивает выражение на лексемы
+func lexExpr(source string) ([]exprToken, error) {
+	var tokens []exprToken
+	runes := []rune(source)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, exprToken{tokIdent, string(runes[start:i]), start})
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			i++
+			for i < len(runes) && unicode.IsDigit(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, exprToken{tokInt, string(runes[start:i]), start})
+		case r == '"' || r == '\'':
+			start := i
+			var sb strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != r; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+					switch runes[i] {
+					case 'n':
+						sb.WriteRune('\n')
+					case 't':
+						sb.WriteRune('\t')
+					default:
+						sb.WriteRune(runes[i])
+					}
+					continue
+				}
+				sb.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d", start)
+			}
+			i++
+			tokens = append(tokens, exprToken{tokString, sb.String(), start})
+		default:
+			// Двухсимвольные операторы проверяем первыми
+			if i+1 < len(runes) {
+				switch op := string(runes[i : i+2]); op {
+				case "&&", "||", "==", "!=", "<=", ">=":
+					tokens = append(tokens, exprToken{tokOp, op, i})
+					i += 2
+					continue
+				}
+			}
+			if !strings.ContainsRune("!<>()[],.", r) {
+				return nil, fmt.Errorf("unexpected character %q at position %d", r, i)
+			}
+			tokens = append(tokens, exprToken{tokOp, string(r), i})
+			i++
+		}
+	}
+	return append(tokens, exprToken{tokEOF, "end of expression", len(runes)}), nil
+}
+
+// Парсер
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept пропускает оператор op, если он следующий
+func (p *exprParser) accept(op string) bool {
+	if tok := p.peek(); tok.kind == tokOp && tok.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expect(op string) error {
+	if !p.accept(op) {
+		tok := p.peek()
+		return fmt.Errorf("expected %q at position %d, got %q", op, tok.pos, tok.text)
+	}
+	return nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkBool("||", left, right); err != nil {
+			return nil, err
+		}
+		left = &logicNode{or: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkBool("&&", left, right); err != nil {
+			return nil, err
+		}
+		left = &logicNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.accept("!") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkBool("!", operand); err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	switch {
+	case tok.kind == tokOp && (tok.text == "==" || tok.text == "!=" || tok.text == "<" || tok.text == "<=" || tok.text == ">" || tok.text == ">="):
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if left.typ() != right.typ() {
+			return nil, fmt.Errorf("cannot compare %s with %s at position %d", left.typ(), right.typ(), tok.pos)
+		}
+		if left.typ() == exprStringList || left.typ() == exprIntList {
+			return nil, fmt.Errorf("lists can only be used with in, at position %d", tok.pos)
+		}
+		if tok.text != "==" && tok.text != "!=" && left.typ() != exprInt && left.typ() != exprString {
+			return nil, fmt.Errorf("operator %s is not defined for %s", tok.text, left.typ())
+		}
+		return &compareNode{op: tok.text, left: left, right: right}, nil
+	case tok.kind == tokIdent && tok.text == "in":
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if !(left.typ() == exprString && right.typ() == exprStringList) && !(left.typ() == exprInt && right.typ() == exprIntList) {
+			return nil, fmt.Errorf("cannot check %s in %s at position %d", left.typ(), right.typ(), tok.pos)
+		}
+		return &inNode{left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *exprParser) parsePostfix() (exprNode, error) {
+	node, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(".") {
+		name := p.next()
+		if name.kind != tokIdent {
+			return nil, fmt.Errorf("expected method name at position %d", name.pos)
+		}
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		var args []exprNode
+		if !p.accept(")") {
+			for {
+				arg, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				args = append(args, arg)
+				if p.accept(")") {
+					break
+				}
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if node, err = newMethodNode(node, name, args); err != nil {
+			return nil, err
+		}
+	}
+	return node, nil
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokString:
+		return &literalNode{t: exprString, value: tok.text}, nil
+	case tokInt:
+		n, err := strconv.ParseInt(tok.text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", tok.text, tok.pos)
+		}
+		return &literalNode{t: exprInt, value: n}, nil
+	case tokIdent:
+		switch tok.text {
+		case "true", "false":
+			return &literalNode{t: exprBool, value: tok.text == "true"}, nil
+		}
+		field, ok := eventExprFields[tok.text]
+		if !ok {
+			return nil, fmt.Errorf("unknown field %q at position %d", tok.text, tok.pos)
+		}
+		return &fieldNode{field: field}, nil
+	case tokOp:
+		switch tok.text {
+		case "(":
+			node, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return node, p.expect(")")
+		case "[":
+			return p.parseList(tok)
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+}
+
+// parseList разбирает список литералов одного типа
+func (p *exprParser) parseList(open exprToken) (exprNode, error) {
+	list := &literalNode{t: exprStringList}
+	var items []any
+	var elem exprType = -1
+	for !p.accept("]") {
+		if len(items) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		item, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		lit, ok := item.(*literalNode)
+		if !ok || (lit.t != exprString && lit.t != exprInt) {
+			return nil, fmt.Errorf("list at position %d must contain only string or int literals", open.pos)
+		}
+		if elem >= 0 && lit.t != elem {
+			return nil, fmt.Errorf("list at position %d mixes element types", open.pos)
+		}
+		elem = lit.t
+		items = append(items, lit.value)
+	}
+	if elem == exprInt {
+		list.t = exprIntList
+	}
+	list.value = items
+	return list, nil
+}
+
+// checkBool проверяет, что операнды логического оператора имеют тип bool
+func checkBool(op string, operands ...exprNode) error {
+	for _, operand := range operands {
+		if operand.typ() != exprBool {
+			return fmt.Errorf("operator %s expects bool, got %s", op, operand.typ())
+		}
+	}
+	return nil
+}
+
+// evalBool вычисляет узел типа bool. Типы проверены при разборе, поэтому
+// несовпадение возможно только при ошибке в самом фильтре: тогда значение ложно, а не паника
+func evalBool(node exprNode, event *EventInfo) bool {
+	value, _ := node.eval(event).(bool)
+	return value
+}
+
+// evalString вычисляет узел типа string
+func evalString(node exprNode, event *EventInfo) string {
+	value, _ := node.eval(event).(string)
+	return value
+}
+
+// Узлы выражения
+
+type literalNode struct {
+	t     exprType
+	value any
+}
+
+func (n *literalNode) typ() exprType       { return n.t }
+func (n *literalNode) eval(*EventInfo) any { return n.value }
+
+type fieldNode struct {
+	field exprField
+}
+
+func (n *fieldNode) typ() exprType             { return n.field.typ }
+func (n *fieldNode) eval(event *EventInfo) any { return n.field.get(event) }
+
+type notNode struct {
+	operand exprNode
+}
+
+func (n *notNode) typ() exprType             { return exprBool }
+func (n *notNode) eval(event *EventInfo) any { return !evalBool(n.operand, event) }
+
+type logicNode struct {
+	or          bool
+	left, right exprNode
+}
+
+func (n *logicNode) typ() exprType { return exprBool }
+func (n *logicNode) eval(event *EventInfo) any {
+	left := evalBool(n.left, event)
+	if n.or {
+		return left || evalBool(n.right, event)
+	}
+	return left && evalBool(n.right, event)
+}
+
+type compareNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *compareNode) typ() exprType { return exprBool }
+func (n *compareNode) eval(event *EventInfo) any {
+	left, right := n.left.eval(event), n.right.eval(event)
+	switch n.op {
+	case "==":
+		return left == right
+	case "!=":
+		return left != right
+	}
+
+	// Упорядочивание определено для чисел и строк
+	var cmp int
+	switch l := left.(type) {
+	case int64:
+		r, _ := right.(int64)
+		switch {
+		case l < r:
+			cmp = -1
+		case l > r:
+			cmp = 1
+		}
+	case string:
+		r, _ := right.(string)
+		cmp = strings.Compare(l, r)
+	}
+	switch n.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+type inNode struct {
+	left, right exprNode
+}
+
+func (n *inNode) typ() exprType { return exprBool }
+func (n *inNode) eval(event *EventInfo) any {
+	value := n.left.eval(event)
+	items, _ := n.right.eval(event).([]any)
+	for _, item := range items {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// methodNode вызов метода строки
+type methodNode struct {
+	name     string
+	receiver exprNode
+	arg      exprNode
+	re       *regexp.Regexp // Скомпилированный литерал для matches
+}
+
+// newMethodNode проверяет вызов метода и заранее компилирует регулярное выражение
+func newMethodNode(receiver exprNode, name exprToken, args []exprNode) (exprNode, error) {
+	if receiver.typ() != exprString {
+		return nil, fmt.Errorf("method %s at position %d is defined only for strings", name.text, name.pos)
+	}
+	node := &methodNode{name: name.text, receiver: receiver}
+	switch name.text {
+	case "lower":
+		if len(args) != 0 {
+			return nil, fmt.Errorf("method lower takes no arguments")
+		}
+		return node, nil
+	case "contains", "startsWith", "endsWith", "matches":
+		if len(args) != 1 || args[0].typ() != exprString {
+			return nil, fmt.Errorf("method %s takes one string argument", name.text)
+		}
+		node.arg = args[0]
+	default:
+		return nil, fmt.Errorf("unknown method %q at position %d", name.text, name.pos)
+	}
+
+	if lit, ok := node.arg.(*literalNode); ok && name.text == "matches" {
+		re, err := regexp.Compile(lit.value.(string))
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression in matches: %w", err)
+		}
+		node.re = re
+	}
+	return node, nil
+}
+
+func (n *methodNode) typ() exprType {
+	if n.name == "lower" {
+		return exprString
+	}
+	return exprBool
+}
+
+func (n *methodNode) eval(event *EventInfo) any {
+	s := evalString(n.receiver, event)
+	if n.name == "lower" {
+		return strings.ToLower(s)
+	}
+
+	arg := evalString(n.arg, event)
+	switch n.name {
+	case "contains":
+		return strings.Contains(s, arg)
+	case "startsWith":
+		return strings.HasPrefix(s, arg)
+	case "endsWith":
+		return strings.HasSuffix(s, arg)
+	}
+
+	// matches с вычисляемым шаблоном компилируется при каждом вызове
+	re := n.re
+	if re == nil {
+		var err error
+		if re, err = regexp.Compile(arg); err != nil {
+			return false
+		}
+	}
+	return re.MatchString(s)
+}
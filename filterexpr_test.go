@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// testFilterEvent сообщение, на котором проверяются выражения и фильтры
+func testFilterEvent() *EventInfo {
+	return &EventInfo{
+		Type:      EventMessage,
+		ChatID:    -1001234,
+		ChatType:  "supergroup",
+		ChatTitle: "Ops",
+		UserID:    42,
+		Username:  "alice",
+		MessageID: 100,
+		Message:   "Deploy started: URGENT",
+		Details: &MessageInfo{
+			IsMentioned:  true,
+			MediaType:    "photo",
+			Media:        &MediaInfo{},
+			ReplyToMsgID: 7,
+		},
+	}
+}
+
+func TestFilterExprEval(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want bool
+	}{
+		// Приоритет: ! выше &&, && выше ||
+		{"and binds tighter than or", `false && false || true`, true},
+		{"and binds tighter than or on the right", `true || false && false`, true},
+		{"parentheses override precedence", `false && (false || true)`, false},
+		{"not binds tighter than and", `!false && false`, false},
+		{"not of a group", `!(false && false)`, true},
+		{"double not", `!!mentioned`, true},
+		{"not before comparison", `!(user_id == 1)`, true},
+
+		{"int equality", `user_id == 42`, true},
+		{"int inequality", `user_id != 42`, false},
+		{"negative int", `chat_id == -1001234`, true},
+		{"int ordering", `user_id < 100 && user_id >= 42 && message_id > 99 && message_id <= 100`, true},
+		{"string equality", `chat_type == "supergroup"`, true},
+		{"string ordering", `username < "bob"`, true},
+		{"single quotes and escapes", `'it\'s' == "it's"`, true},
+		{"empty field", `first_name == ""`, true},
+		{"bool fields", `mentioned && has_media && !outgoing && !forwarded`, true},
+		{"message fields", `media_type == "photo" && reply_to == 7 && topic_id == 0`, true},
+
+		{"string in list", `type in ["message", "edit"]`, true},
+		{"string not in list", `chat_type in ["user", "chat"]`, false},
+		{"int in list", `user_id in [1, 42]`, true},
+		{"negated in", `!(user_id in [1, 2])`, true},
+
+		{"contains", `text.contains("URGENT")`, true},
+		{"contains is case sensitive", `text.contains("urgent")`, false},
+		{"lower then contains", `text.lower().contains("urgent")`, true},
+		{"startsWith", `text.startsWith("Deploy")`, true},
+		{"endsWith", `text.endsWith("started")`, false},
+		{"matches literal", `text.matches("^Deploy .*URGENT$")`, true},
+		{"matches after lower", `text.lower().matches("deploy|rollback")`, true},
+		{"matches field pattern", `text.matches(username)`, false},
+		{"method argument is a field", `text.contains(chat_title)`, false},
+		{"method on literal", `"ABC".lower() == "abc"`, true},
+	}
+
+	event := testFilterEvent()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := compileFilterExpr(tt.expr)
+			if err != nil {
+				t.Fatalf("compileFilterExpr(%q): %v", tt.expr, err)
+			}
+			if got := evalBool(node, event); got != tt.want {
+				t.Errorf("%q = %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterExprErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`text`, "must be bool, got string"},
+		{`user_id == "42"`, "cannot compare int with string"},
+		{`mentioned && user_id`, "operator && expects bool, got int"},
+		{`text || mentioned`, "operator || expects bool, got string"},
+		{`!text`, "operator ! expects bool, got string"},
+		{`mentioned < true`, "operator < is not defined for bool"},
+		{`[1] == [1]`, "lists can only be used with in"},
+		{`user_id in ["a"]`, "cannot check int in list(string)"},
+		{`user_id in [1, "a"]`, "mixes element types"},
+		{`user_id in [chat_id]`, "only string or int literals"},
+		{`user_id.contains("1")`, "defined only for strings"},
+		{`text.foo()`, `unknown method "foo"`},
+		{`text.contains(1)`, "takes one string argument"},
+		{`text.lower("a")`, "takes no arguments"},
+		{`text.matches("(")`, "invalid regular expression"},
+		{`sender == 1`, `unknown field "sender"`},
+		{`text == "abc`, "unterminated string"},
+		{`user_id == 1 @`, "unexpected character"},
+		{`(mentioned`, `expected ")"`},
+		{`mentioned mentioned`, `unexpected "mentioned"`},
+		{``, "unexpected"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := compileFilterExpr(tt.expr)
+			if err == nil {
+				t.Fatalf("compileFilterExpr(%q) succeeded, want error %q", tt.expr, tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("compileFilterExpr(%q) error = %q, want it to contain %q", tt.expr, err, tt.want)
+			}
+		})
+	}
+}
+
+// Узлы с неверными типами значений не должны приводить к панике
+func TestFilterExprEvalMismatchedTypes(t *testing.T) {
+	str := &literalNode{t: exprString, value: "x"}
+	num := &literalNode{t: exprInt, value: int64(1)}
+	nodes := []exprNode{
+		&notNode{operand: str},
+		&logicNode{left: str, right: num},
+		&compareNode{op: "<", left: num, right: str},
+		&compareNode{op: ">", left: str, right: num},
+		&inNode{left: str, right: str},
+		&methodNode{name: "contains", receiver: num, arg: num},
+	}
+	event := testFilterEvent()
+	for _, node := range nodes {
+		evalBool(node, event)
+	}
+}
+
+func TestEventFilterMatch(t *testing.T) {
+	tests := []struct {
+		name string
+		opts EventFilterOptions
+		want bool
+	}{
+		{"no conditions", EventFilterOptions{}, true},
+		{"--chats match", EventFilterOptions{Chats: []string{"-1001234"}}, true},
+		{"--chats mismatch", EventFilterOptions{Chats: []string{"-1005678"}}, false},
+		{"--exclude-chats match", EventFilterOptions{ExcludeChats: []string{"-1001234"}}, false},
+		{"--exclude-chats mismatch", EventFilterOptions{ExcludeChats: []string{"-1005678"}}, true},
+		{"--types match", EventFilterOptions{Types: []EventType{EventMessage, EventEdit}}, true},
+		{"--types mismatch", EventFilterOptions{Types: []EventType{EventDelete}}, false},
+		{"--from match", EventFilterOptions{From: []string{"42"}}, true},
+		{"--from mismatch", EventFilterOptions{From: []string{"43"}}, false},
+		{"--regex match", EventFilterOptions{Regex: `(?i)deploy`}, true},
+		{"--regex mismatch", EventFilterOptions{Regex: `rollback`}, false},
+		{"--only-mentions", EventFilterOptions{OnlyMentions: true}, true},
+		{"--only-incoming", EventFilterOptions{OnlyIncoming: true}, true},
+		{"--has-media", EventFilterOptions{HasMedia: true}, true},
+		{"--chat-types match", EventFilterOptions{ChatTypes: []string{"supergroup", "channel"}}, true},
+		{"--chat-types mismatch", EventFilterOptions{ChatTypes: []string{"user"}}, false},
+		{"--filter match", EventFilterOptions{Expr: `text.contains("URGENT")`}, true},
+		{"--filter mismatch", EventFilterOptions{Expr: `user_id == 1`}, false},
+		{"--filter is combined with AND", EventFilterOptions{Chats: []string{"-1005678"}, Expr: `true`}, false},
+	}
+
+	event := testFilterEvent()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Числовые ID разрешаются без обращения к API
+			filter, err := newEventFilter(context.Background(), nil, tt.opts)
+			if err != nil {
+				t.Fatalf("newEventFilter: %v", err)
+			}
+			if got := filter.Match(event); got != tt.want {
+				t.Errorf("Match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Условия на содержимое не пропускают события без сообщения и исходящие
+func TestEventFilterMatchMessageConditions(t *testing.T) {
+	status := &EventInfo{Type: EventUserStatus, UserID: 42}
+	tooLong := &EventInfo{Type: EventChannelTooLong, ChatID: -1001234, ChatType: "channel"}
+	outgoing := testFilterEvent()
+	outgoing.Details.IsOutgoing = true
+	plain := testFilterEvent()
+	plain.Details = &MessageInfo{}
+
+	tests := []struct {
+		name  string
+		opts  EventFilterOptions
+		event *EventInfo
+		want  bool
+	}{
+		{"--only-mentions without message", EventFilterOptions{OnlyMentions: true}, status, false},
+		{"--only-mentions not mentioned", EventFilterOptions{OnlyMentions: true}, plain, false},
+		{"--has-media without message", EventFilterOptions{HasMedia: true}, status, false},
+		{"--has-media without media", EventFilterOptions{HasMedia: true}, plain, false},
+		{"--only-incoming outgoing", EventFilterOptions{OnlyIncoming: true}, outgoing, false},
+		{"--only-incoming keeps non-messages", EventFilterOptions{OnlyIncoming: true}, status, true},
+		{"channel_too_long ignores content conditions", EventFilterOptions{Regex: "x", From: []string{"42"}, OnlyMentions: true, Expr: `false`}, tooLong, true},
+		{"channel_too_long respects --chats", EventFilterOptions{Chats: []string{"-1005678"}}, tooLong, false},
+		{"channel_too_long respects --types", EventFilterOptions{Types: []EventType{EventMessage}}, tooLong, false},
+		{"--from matches sender chat", EventFilterOptions{From: []string{"-1009"}}, &EventInfo{
+			Type:    EventMessage,
+			Details: &MessageInfo{SenderChat: &MessageSender{ID: 9, ChatID: -1009, Type: "channel"}},
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := newEventFilter(context.Background(), nil, tt.opts)
+			if err != nil {
+				t.Fatalf("newEventFilter: %v", err)
+			}
+			if got := filter.Match(tt.event); got != tt.want {
+				t.Errorf("Match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventFilterOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		opts EventFilterOptions
+		want string
+	}{
+		{"unknown type", EventFilterOptions{Types: []EventType{"reaction"}}, `unknown event type "reaction"`},
+		{"unknown chat type", EventFilterOptions{ChatTypes: []string{"group"}}, `unknown chat type "group"`},
+		{"invalid regex", EventFilterOptions{Regex: `(`}, "invalid regex"},
+		{"invalid expression", EventFilterOptions{Expr: `text`}, "invalid filter expression"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("validate() = %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gotd/td/telegram/message/entity"
+	"github.com/gotd/td/telegram/message/html"
+	"github.com/gotd/td/tg"
+)
+
+// Режимы разметки текста сообщения
+const (
+	ParseModeNone     = ""
+	ParseModeMarkdown = "markdown"
+	ParseModeHTML     = "html"
+)
+
+// parseFormattedText преобразует размеченный текст в чистый текст и сущности Telegram
+func parseFormattedText(text, parseMode string) (string, []tg.MessageEntityClass, error) {
+	switch parseMode {
+	case ParseModeNone:
+		return text, nil, nil
+	case ParseModeHTML:
+		var builder entity.Builder
+		if err := html.HTML(strings.NewReader(text), &builder, html.Options{}); err != nil {
+			return "", nil, fmt.Errorf("failed to parse HTML: %w", err)
+		}
+		message, entities := builder.Complete()
+		return message, entities, nil
+	case ParseModeMarkdown:
+		p := &markdownParser{}
+		p.parse(text)
+		sort.SliceStable(p.entities, func(i, j int) bool {
+			a, b := p.entities[i], p.entities[j]
+			if a.GetOffset() != b.GetOffset() {
+				return a.GetOffset() < b.GetOffset()
+			}
+			return a.GetLength() > b.GetLength()
+		})
+		return p.text.String(), p.entities, nil
+	default:
+		return "", nil, fmt.Errorf("unknown parse mode %q: expected markdown or html", parseMode)
+	}
+}
+
+// markdownParser разбирает упрощенный Markdown в текст и сущности.
+//
+// Поддерживаются **жирный**, *курсив* или _курсив_, __подчеркнутый__,
+// ~~зачеркнутый~~, ||спойлер||, `код`, ```язык\nблок кода```,
+// [текст](https://url), [имя](tg://user?id=123), ![😀](tg://emoji?id=123)
+// и цитаты из строк, начинающихся с >. Символы экранируются через \.
+type markdownParser struct {
+	text     strings.Builder
+	utf16    int
+	entities []tg.MessageEntityClass
+}
+
+// markdownMarkers парные маркеры стилей; более длинные проверяются первыми
+var markdownMarkers = []struct {
+	marker string
+	create func(offset, length int) tg.MessageEntityClass
+}{
+	{"**", func(o, l int) tg.MessageEntityClass { return &tg.MessageEntityBold{Offset: o, Length: l} }},
+	{"__", func(o, l int) tg.MessageEntityClass { return &tg.MessageEntityUnderline{Offset: o, Length: l} }},
+	{"~~", func(o, l int) tg.MessageEntityClass { return &tg.MessageEntityStrike{Offset: o, Length: l} }},
+	{"||", func(o, l int) tg.MessageEntityClass { return &tg.MessageEntitySpoiler{Offset: o, Length: l} }},
+	{"*", func(o, l int) tg.MessageEntityClass { return &tg.MessageEntityItalic{Offset: o, Length: l} }},
+	{"_", func(o, l int) tg.MessageEntityClass { return &tg.MessageEntityItalic{Offset: o, Length: l} }},
+}
+
+// write добавляет текст, учитывая длину в UTF-16
+func (p *markdownParser) write(s string) {
+	p.text.WriteString(s)
+	p.utf16 += utf16Len(s)
+}
+
+// parse разбирает фрагмент разметки
+func (p *markdownParser) parse(s string) {
+	for i := 0; i < len(s); {
+		// Экранированный символ выводим как есть
+		if s[i] == '\\' && i+1 < len(s) {
+			_, size := utf8.DecodeRuneInString(s[i+1:])
+			p.write(s[i+1 : i+1+size])
+			i += 1 + size
+			continue
+		}
+
+		// Блок кода ```язык\n...```
+		if strings.HasPrefix(s[i:], "```") {
+			if end := strings.Index(s[i+3:], "```"); end >= 0 {
+				content := s[i+3 : i+3+end]
+				language := ""
+				if nl := strings.IndexByte(content, '\n'); nl >= 0 && !strings.ContainsAny(content[:nl], " \t") {
+					language = content[:nl]
+					content = content[nl+1:]
+				}
+				start := p.utf16
+				p.write(content)
+				p.entities = append(p.entities, &tg.MessageEntityPre{Offset: start, Length: p.utf16 - start, Language: language})
+				i += 3 + end + 3
+				continue
+			}
+		}
+
+		// Цитата из подряд идущих строк, начинающихся с >
+		if s[i] == '>' && p.atLineStart() {
+			i += p.parseBlockquote(s[i:])
+			continue
+		}
+
+		// Однострочный код `...`
+		if s[i] == '`' {
+			if end := strings.IndexByte(s[i+1:], '`'); end > 0 {
+				start := p.utf16
+				p.write(s[i+1 : i+1+end])
+				p.entities = append(p.entities, &tg.MessageEntityCode{Offset: start, Length: p.utf16 - start})
+				i += 1 + end + 1
+				continue
+			}
+		}
+
+		// Пользовательский эмодзи ![😀](tg://emoji?id=123)
+		if strings.HasPrefix(s[i:], "![") {
+			if n, ok := p.parseLink(s[i+1:], true); ok {
+				i += 1 + n
+				continue
+			}
+		}
+
+		// Ссылка [текст](url)
+		if s[i] == '[' {
+			if n, ok := p.parseLink(s[i:], false); ok {
+				i += n
+				continue
+			}
+		}
+
+		// Парные маркеры стилей
+		if n, ok := p.parseStyle(s, i); ok {
+			i += n
+			continue
+		}
+
+		_, size := utf8.DecodeRuneInString(s[i:])
+		p.write(s[i : i+size])
+		i += size
+	}
+}
+
+// atLineStart сообщает, начинается ли с текущей позиции новая строка текста
+func (p *markdownParser) atLineStart() bool {
+	return p.text.Len() == 0 || strings.HasSuffix(p.text.String(), "\n")
+}
+
+// parseBlockquote разбирает цитату и возвращает количество прочитанных байт.
+// Перевод строки после последней строки цитаты в нее не входит.
+func (p *markdownParser) parseBlockquote(s string) int {
+	var lines []string
+	n := 0
+	for n < len(s) && s[n] == '>' {
+		end := strings.IndexByte(s[n:], '\n')
+		if end < 0 {
+			lines = append(lines, s[n+1:])
+			n = len(s)
+			break
+		}
+		lines = append(lines, s[n+1:n+end])
+		if n+end+1 >= len(s) || s[n+end+1] != '>' {
+			n += end
+			break
+		}
+		n += end + 1
+	}
+
+	start := p.utf16
+	p.parse(strings.Join(lines, "\n"))
+	if length := p.utf16 - start; length > 0 {
+		p.entities = append(p.entities, &tg.MessageEntityBlockquote{Offset: start, Length: length})
+	}
+	return n
+}
+
+// parseLink разбирает ссылку в начале строки и возвращает количество прочитанных байт.
+// При emoji ссылка должна указывать на пользовательский эмодзи tg://emoji?id=.
+func (p *markdownParser) parseLink(s string, emoji bool) (int, bool) {
+	closeText := findMarker(s[1:], "]")
+	if closeText < 0 || !strings.HasPrefix(s[1+closeText:], "](") {
+		return 0, false
+	}
+	urlStart := 1 + closeText + 2
+	closeURL := strings.IndexByte(s[urlStart:], ')')
+	if closeURL < 0 {
+		return 0, false
+	}
+	label := s[1 : 1+closeText]
+	target := s[urlStart : urlStart+closeURL]
+	emojiID, isEmoji := tgLinkID(target, "tg://emoji?id=")
+	if emoji != isEmoji {
+		return 0, false
+	}
+
+	start := p.utf16
+	p.parse(label)
+	length := p.utf16 - start
+	if length > 0 {
+		if isEmoji {
+			p.entities = append(p.entities, &tg.MessageEntityCustomEmoji{Offset: start, Length: length, DocumentID: emojiID})
+		} else if userID, ok := mentionUserID(target); ok {
+			p.entities = append(p.entities, &tg.InputMessageEntityMentionName{
+				Offset: start,
+				Length: length,
+				UserID: &tg.InputUser{UserID: userID},
+			})
+		} else {
+			p.entities = append(p.entities, &tg.MessageEntityTextURL{Offset: start, Length: length, URL: target})
+		}
+	}
+	return urlStart + closeURL + 1, true
+}
+
+// parseStyle разбирает парный маркер стиля в позиции i
+func (p *markdownParser) parseStyle(s string, i int) (int, bool) {
+	for _, m := range markdownMarkers {
+		if !strings.HasPrefix(s[i:], m.marker) {
+			continue
+		}
+		// Одиночное подчеркивание внутри слова (snake_case) не считается разметкой
+		if m.marker == "_" && i > 0 {
+			prev, _ := utf8.DecodeLastRuneInString(s[:i])
+			if unicode.IsLetter(prev) || unicode.IsDigit(prev) {
+				return 0, false
+			}
+		}
+
+		contentStart := i + len(m.marker)
+		end := findMarker(s[contentStart:], m.marker)
+		if end <= 0 {
+			continue
+		}
+
+		start := p.utf16
+		p.parse(s[contentStart : contentStart+end])
+		if length := p.utf16 - start; length > 0 {
+			p.entities = append(p.entities, m.create(start, length))
+		}
+		return len(m.marker) + end + len(m.marker), true
+	}
+	return 0, false
+}
+
+// findMarker ищет неэкранированный маркер в строке
+func findMarker(s, marker string) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.HasPrefix(s[i:], marker) {
+			// Для одиночных маркеров пропускаем удвоенные (** внутри *...*)
+			if len(marker) == 1 && strings.HasPrefix(s[i+1:], marker) {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+// mentionUserID извлекает ID пользователя из ссылки tg://user?id=123
+func mentionUserID(target string) (int64, bool) {
+	return tgLinkID(target, "tg://user?id=")
+}
+
+// tgLinkID извлекает числовой ID из ссылки вида tg://...?id=123 с указанным префиксом
+func tgLinkID(target, prefix string) (int64, bool) {
+	if !strings.HasPrefix(target, prefix) {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(target, prefix), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// utf16Len возвращает длину строки в кодовых единицах UTF-16, в которых Telegram считает смещения
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		text     string
+		entities []MessageEntity
+	}{
+		{
+			name:  "plain text",
+			input: "hello",
+			text:  "hello",
+		},
+		{
+			name:  "nested styles",
+			input: "a **b _c_ d** e",
+			text:  "a b c d e",
+			entities: []MessageEntity{
+				{Type: "bold", Offset: 2, Length: 5},
+				{Type: "italic", Offset: 4, Length: 1},
+			},
+		},
+		{
+			// 😀 занимает две кодовые единицы UTF-16
+			name:  "offsets after surrogate pairs",
+			input: "😀 **😀x** __y__",
+			text:  "😀 😀x y",
+			entities: []MessageEntity{
+				{Type: "bold", Offset: 3, Length: 3},
+				{Type: "underline", Offset: 7, Length: 1},
+			},
+		},
+		{
+			// 👍🏽 — эмодзи с модификатором, четыре кодовые единицы
+			name:  "link with emoji label",
+			input: "[👍🏽 ok](https://example.com) end",
+			text:  "👍🏽 ok end",
+			entities: []MessageEntity{
+				{Type: "text_url", Offset: 0, Length: 7, URL: "https://example.com"},
+			},
+		},
+		{
+			name:  "mention and custom emoji",
+			input: "[Bob](tg://user?id=42) ![🙂](tg://emoji?id=5)",
+			text:  "Bob 🙂",
+			entities: []MessageEntity{
+				{Type: "mention_name", Offset: 0, Length: 3, UserID: 42},
+				{Type: "custom_emoji", Offset: 4, Length: 2, CustomEmojiID: 5},
+			},
+		},
+		{
+			name:  "spoiler, strike and code",
+			input: "||👨‍👩‍👧|| ~~s~~ `**`",
+			text:  "👨‍👩‍👧 s **",
+			entities: []MessageEntity{
+				{Type: "spoiler", Offset: 0, Length: 8},
+				{Type: "strike", Offset: 9, Length: 1},
+				{Type: "code", Offset: 11, Length: 2},
+			},
+		},
+		{
+			name:  "code block with language",
+			input: "```go\nx := \"😀\"\n```",
+			text:  "x := \"😀\"\n",
+			entities: []MessageEntity{
+				{Type: "pre", Offset: 0, Length: 10, Language: "go"},
+			},
+		},
+		{
+			name:  "blockquote",
+			input: ">quote 😀\n>**line**\nafter",
+			text:  "quote 😀\nline\nafter",
+			entities: []MessageEntity{
+				{Type: "blockquote", Offset: 0, Length: 13},
+				{Type: "bold", Offset: 9, Length: 4},
+			},
+		},
+		{
+			name:  "escapes and snake_case",
+			input: `a\*b\_ snake_case_var`,
+			text:  "a*b_ snake_case_var",
+		},
+		{
+			name:  "italic inside a word",
+			input: "x*y*z",
+			text:  "xyz",
+			entities: []MessageEntity{
+				{Type: "italic", Offset: 1, Length: 1},
+			},
+		},
+		{
+			name:  "unpaired markers",
+			input: "2 * 3 ** 4",
+			text:  "2 * 3 ** 4",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities, err := parseFormattedText(tt.input, ParseModeMarkdown)
+			if err != nil {
+				t.Fatalf("parseFormattedText: %v", err)
+			}
+			if text != tt.text {
+				t.Errorf("text = %q, want %q", text, tt.text)
+			}
+			got := extractEntities(entities)
+			if len(got) == 0 && len(tt.entities) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.entities) {
+				t.Errorf("entities = %+v, want %+v", got, tt.entities)
+			}
+		})
+	}
+}
+
+func TestParseHTML(t *testing.T) {
+	text, entities, err := parseFormattedText(`😀 <b>bold <i>😀</i></b> <a href="https://e.x?a=1&amp;b=2">a&lt;b</a>`, ParseModeHTML)
+	if err != nil {
+		t.Fatalf("parseFormattedText: %v", err)
+	}
+	if want := "😀 bold 😀 a<b"; text != want {
+		t.Errorf("text = %q, want %q", text, want)
+	}
+	want := []MessageEntity{
+		{Type: "bold", Offset: 3, Length: 7},
+		{Type: "italic", Offset: 8, Length: 2},
+		{Type: "text_url", Offset: 11, Length: 3, URL: "https://e.x?a=1&b=2"},
+	}
+	if got := extractEntities(entities); !reflect.DeepEqual(got, want) {
+		t.Errorf("entities = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseFormattedTextUnknownMode(t *testing.T) {
+	if _, _, err := parseFormattedText("x", "bbcode"); err == nil {
+		t.Error("expected error for unknown parse mode")
+	}
+}
+
+func TestUTF16Len(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{"", 0},
+		{"abc", 3},
+		{"привет", 6},
+		{"😀", 2},
+		{"👍🏽", 4},
+		{"👨‍👩‍👧", 8},
+	}
+	for _, tt := range tests {
+		if got := utf16Len(tt.s); got != tt.want {
+			t.Errorf("utf16Len(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
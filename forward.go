@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gotd/td/tg"
+)
+
+// ForwardInfo описывает происхождение пересланного сообщения
+type ForwardInfo struct {
+	Date            int            `json:"date"`
+	From            *MessageSender `json:"from,omitempty"`
+	FromChatID      int64          `json:"from_chat_id,omitempty"`
+	FromName        string         `json:"from_name,omitempty"`
+	ChannelPost     int            `json:"channel_post,omitempty"`
+	PostAuthor      string         `json:"post_author,omitempty"`
+	Link            string         `json:"link,omitempty"`
+	SavedFromChatID int64          `json:"saved_from_chat_id,omitempty"`
+	SavedFromMsgID  int            `json:"saved_from_msg_id,omitempty"`
+	SavedFromName   string         `json:"saved_from_name,omitempty"`
+	SavedDate       int            `json:"saved_date,omitempty"`
+	Imported        bool           `json:"imported,omitempty"`
+	PsaType         string         `json:"psa_type,omitempty"`
+}
+
+// extractForward собирает сведения о первоисточнике пересланного сообщения
+func extractForward(fwd tg.MessageFwdHeader, userMap map[int64]tg.UserClass, chatMap map[int64]tg.ChatClass) *ForwardInfo {
+	info := &ForwardInfo{
+		Date:          fwd.Date,
+		FromName:      fwd.FromName,
+		ChannelPost:   fwd.ChannelPost,
+		PostAuthor:    fwd.PostAuthor,
+		SavedFromName: fwd.SavedFromName,
+		SavedDate:     fwd.SavedDate,
+		Imported:      fwd.Imported,
+		PsaType:       fwd.PsaType,
+	}
+
+	// Исходный отправитель; при скрытой пересылке известно только имя FromName
+	if fwd.FromID != nil {
+		info.From = peerSender(fwd.FromID, userMap, chatMap)
+		if _, ok := fwd.FromID.(*tg.PeerUser); !ok {
+			info.FromChatID = peerToChatID(fwd.FromID)
+		}
+		if fwd.ChannelPost != 0 {
+			info.Link = messageLink(fwd.FromID, fwd.ChannelPost, chatMap)
+		}
+	}
+
+	// Сообщение сохранено в «Избранное» из другого чата
+	if fwd.SavedFromPeer != nil {
+		info.SavedFromChatID = peerToChatID(fwd.SavedFromPeer)
+		info.SavedFromMsgID = fwd.SavedFromMsgID
+		if info.Link == "" && fwd.SavedFromMsgID != 0 {
+			info.Link = messageLink(fwd.SavedFromPeer, fwd.SavedFromMsgID, chatMap)
+		}
+	}
+	return info
+}
+
+// peerSender описывает пользователя или чат по Peer; без данных в ответе заполняются только ID
+func peerSender(peer tg.PeerClass, userMap map[int64]tg.UserClass, chatMap map[int64]tg.ChatClass) *MessageSender {
+	switch p := peer.(type) {
+	case *tg.PeerUser:
+		if u, ok := userMap[p.UserID].(*tg.User); ok {
+			return &MessageSender{
+				ID:        u.GetID(),
+				Type:      "user",
+				Username:  u.Username,
+				FirstName: u.FirstName,
+				LastName:  u.LastName,
+				IsBot:     u.Bot,
+			}
+		}
+		return &MessageSender{ID: p.UserID, Type: "user"}
+	case *tg.PeerChat:
+		if sender := chatSender(chatMap[p.ChatID]); sender != nil {
+			return sender
+		}
+		return &MessageSender{ID: p.ChatID, ChatID: peerToChatID(p), Type: "chat"}
+	case *tg.PeerChannel:
+		if sender := chatSender(chatMap[p.ChannelID]); sender != nil {
+			return sender
+		}
+		return &MessageSender{ID: p.ChannelID, ChatID: peerToChatID(p), Type: "channel"}
+	}
+	return nil
+}
+
+// chatSender описывает группу, супергруппу или канал как отправителя
+func chatSender(chat tg.ChatClass) *MessageSender {
+	switch c := chat.(type) {
+	case *tg.Chat:
+		return &MessageSender{
+			ID:        c.ID,
+			ChatID:    peerToChatID(&tg.PeerChat{ChatID: c.ID}),
+			Type:      "chat",
+			FirstName: c.Title,
+		}
+	case *tg.Channel:
+		channelType := "channel"
+		if c.Megagroup {
+			channelType = "supergroup"
+		}
+		return &MessageSender{
+			ID:        c.ID,
+			ChatID:    peerToChatID(&tg.PeerChannel{ChannelID: c.ID}),
+			Type:      channelType,
+			Username:  c.Username,
+			FirstName: c.Title,
+		}
+	}
+	return nil
+}
+
+// senderChat определяет чат, от имени которого отправлено сообщение:
+// сам канал для постов без автора, группу для анонимных администраторов
+// или канал, от имени которого написали в группе
+func senderChat(msg *tg.Message, chatMap map[int64]tg.ChatClass) *MessageSender {
+	peer := msg.FromID
+	if peer == nil {
+		// Посты каналов приходят без отправителя
+		if _, ok := msg.PeerID.(*tg.PeerChannel); !ok {
+			return nil
+		}
+		peer = msg.PeerID
+	}
+	if _, ok := peer.(*tg.PeerUser); ok {
+		return nil
+	}
+
+	return peerSender(peer, nil, chatMap)
+}
+
+// messageLink строит ссылку t.me на сообщение в канале или супергруппе
+func messageLink(peer tg.PeerClass, msgID int, chatMap map[int64]tg.ChatClass) string {
+	p, ok := peer.(*tg.PeerChannel)
+	if !ok {
+		// На сообщения в личных чатах и обычных группах ссылок нет
+		return ""
+	}
+	if c, ok := chatMap[p.ChannelID].(*tg.Channel); ok && c.Username != "" {
+		return fmt.Sprintf("https://t.me/%s/%d", c.Username, msgID)
+	}
+	return fmt.Sprintf("https://t.me/c/%d/%d", p.ChannelID, msgID)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// historyBatchSize максимальное количество сообщений, которое Telegram отдает за один запрос
+const historyBatchSize = 100
+
+// HistoryOptions задает параметры выборки истории сообщений
+type HistoryOptions struct {
+	Limit    int       // Максимальное количество сообщений (игнорируется при All)
+	OffsetID int       // Начинать с сообщений старше указанного ID
+	MinID    int       // Возвращать только сообщения с ID больше указанного
+	MaxID    int       // Возвращать только сообщения с ID меньше указанного
+	Since    time.Time // Нижняя граница даты сообщений
+	Until    time.Time // Верхняя граница даты сообщений
+	All      bool      // Выгрузить всю историю постранично
+	Render   string    // Формат текста с разметкой: markdown, html или plain
+	TopicID  int       // Только сообщения указанной темы форума
+}
+
+// historyPageFetcher запрашивает одну страницу истории начиная с указанного смещения
+type historyPageFetcher func(ctx context.Context, offsetID, offsetDate, limit int) (tg.MessagesMessagesClass, error)
+
+// walkHistory постранично обходит историю и передает каждое сообщение в emit
+func walkHistory(ctx context.Context, fetch historyPageFetcher, opts HistoryOptions, chatID int64, emit func(MessageInfo) error) error {
+	offsetID := opts.OffsetID
+	var offsetPeer int64
+	offsetDate := 0
+	if !opts.Until.IsZero() {
+		offsetDate = int(opts.Until.Unix())
+	}
+
+	total := 0
+	for {
+		// Определяем размер очередной страницы
+		batch := historyBatchSize
+		if !opts.All {
+			remaining := opts.Limit - total
+			if remaining <= 0 {
+				return nil
+			}
+			if remaining < batch {
+				batch = remaining
+			}
+		}
+
+		history, err := withFloodWait(ctx, func() (tg.MessagesMessagesClass, error) {
+			return fetch(ctx, offsetID, offsetDate, batch)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get messages: %w", err)
+		}
+
+		raw, err := historyMessages(history)
+		if err != nil {
+			return err
+		}
+		if len(raw) == 0 {
+			return nil
+		}
+
+		page, err := extractMessages(history, chatID)
+		if err != nil {
+			return fmt.Errorf("failed to extract messages: %w", err)
+		}
+
+		// Отдаем сообщения, пока не вышли за нижнюю границу даты или лимит
+		for _, msg := range page.Messages {
+			if !opts.Since.IsZero() && int64(msg.Date) < opts.Since.Unix() {
+				return nil
+			}
+			if msg.Rendered, err = renderText(msg.Text, msg.Entities, opts.Render); err != nil {
+				return err
+			}
+			if err := emit(msg); err != nil {
+				return err
+			}
+			total++
+			if !opts.All && total >= opts.Limit {
+				return nil
+			}
+		}
+
+		// Сдвигаем смещение на последнее полученное сообщение. В глобальном поиске
+		// ID повторяются в разных чатах, поэтому сравниваем и чат сообщения
+		lastID, lastDate := messageIDAndDate(raw[len(raw)-1])
+		lastPeer := messagePeerID(raw[len(raw)-1])
+		if lastID == 0 || (lastID == offsetID && lastPeer == offsetPeer) {
+			return nil
+		}
+		if !opts.Since.IsZero() && int64(lastDate) < opts.Since.Unix() {
+			return nil
+		}
+		offsetID, offsetPeer = lastID, lastPeer
+		offsetDate = 0
+
+		// Полный ответ (не срез) означает, что история закончилась
+		if _, ok := history.(*tg.MessagesMessages); ok {
+			return nil
+		}
+	}
+}
+
+// historyMessages возвращает сообщения из ответа API без преобразования
+func historyMessages(historyClass tg.MessagesMessagesClass) ([]tg.MessageClass, error) {
+	switch h := historyClass.(type) {
+	case *tg.MessagesMessages:
+		return h.Messages, nil
+	case *tg.MessagesMessagesSlice:
+		return h.Messages, nil
+	case *tg.MessagesChannelMessages:
+		return h.Messages, nil
+	case *tg.MessagesMessagesNotModified:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unexpected type of messages: %T", historyClass)
+	}
+}
+
+// messageIDAndDate возвращает ID и дату сообщения любого типа
+func messageIDAndDate(msg tg.MessageClass) (int, int) {
+	switch m := msg.(type) {
+	case *tg.Message:
+		return m.ID, m.Date
+	case *tg.MessageService:
+		return m.ID, m.Date
+	case *tg.MessageEmpty:
+		return m.ID, 0
+	}
+	return 0, 0
+}
+
+// messagePeerID возвращает чат сообщения в формате Bot API
+func messagePeerID(msg tg.MessageClass) int64 {
+	if m, ok := msg.(interface{ GetPeerID() tg.PeerClass }); ok {
+		return peerToChatID(m.GetPeerID())
+	}
+	return 0
+}
+
+// withFloodWait выполняет запрос и повторяет его после ожидания при FLOOD_WAIT
+func withFloodWait[T any](ctx context.Context, call func() (T, error)) (T, error) {
+	for {
+		result, err := call()
+		if err == nil {
+			return result, nil
+		}
+
+		if d, ok := tgerr.AsFloodWait(err); ok {
+			fmt.Fprintf(os.Stderr, "FLOOD_WAIT: waiting %s before retry\n", d)
+		}
+		retry, err := tgerr.FloodWait(ctx, err)
+		if !retry {
+			var zero T
+			return zero, err
+		}
+	}
+}
@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
-	"time"
+	"syscall"
 )
 
 func main() {
@@ -32,16 +34,118 @@ func main() {
 		}
 	case CommandMessages:
 		// Получение сообщений из чата
-		if err := runMessages(config.AuthConfig, config.ChatID, config.Limit); err != nil {
+		if err := runMessages(config.AuthConfig, config.ChatID, config.History, config.Download); err != nil {
 			fmt.Printf("Failed to get messages: %v\n", err)
 			os.Exit(1)
 		}
 	case CommandEvents:
 		// Отслеживание событий Telegram
-		if err := runEvents(config.AuthConfig, config.Timeout); err != nil {
+		if err := runEvents(config.AuthConfig, config.Events); err != nil {
 			fmt.Printf("Failed to track events: %v\n", err)
 			os.Exit(1)
 		}
+	case CommandDaemon:
+		// Отслеживание событий под наблюдением
+		if err := runDaemon(config); err != nil {
+			fmt.Fprintf(os.Stderr, "Daemon stopped: %v\n", err)
+			// Отдельный код, чтобы супервизор не перезапускал демон без новой сессии
+			if errors.Is(err, errSessionRevoked) {
+				os.Exit(2)
+			}
+			os.Exit(1)
+		}
+	case CommandSearch:
+		// Поиск сообщений
+		if err := runSearch(config.AuthConfig, config.Search); err != nil {
+			fmt.Printf("Failed to search messages: %v\n", err)
+			os.Exit(1)
+		}
+	case CommandSend:
+		// Отправка сообщения
+		if err := runSend(config.AuthConfig, config.Send); err != nil {
+			fmt.Printf("Failed to send message: %v\n", err)
+			os.Exit(1)
+		}
+	case CommandEdit:
+		// Редактирование сообщения
+		if err := runMessageAction(func(ctx context.Context) error {
+			return EditMessage(ctx, config.AuthConfig, config.Edit)
+		}); err != nil {
+			fmt.Printf("Failed to edit message: %v\n", err)
+			os.Exit(1)
+		}
+	case CommandDelete:
+		// Удаление сообщений
+		if err := runMessageAction(func(ctx context.Context) error {
+			return DeleteMessages(ctx, config.AuthConfig, config.Delete)
+		}); err != nil {
+			fmt.Printf("Failed to delete messages: %v\n", err)
+			os.Exit(1)
+		}
+	case CommandPin, CommandUnpin:
+		// Закрепление или открепление сообщения
+		if err := runMessageAction(func(ctx context.Context) error {
+			return PinMessage(ctx, config.AuthConfig, config.Pin)
+		}); err != nil {
+			fmt.Printf("Failed to %s message: %v\n", config.Command, err)
+			os.Exit(1)
+		}
+	case CommandForward:
+		// Пересылка сообщений
+		if err := runMessageAction(func(ctx context.Context) error {
+			return ForwardMessages(ctx, config.AuthConfig, config.Forward)
+		}); err != nil {
+			fmt.Printf("Failed to forward messages: %v\n", err)
+			os.Exit(1)
+		}
+	case CommandDownload:
+		// Скачивание медиа из сообщения
+		if err := runMessageAction(func(ctx context.Context) error {
+			return DownloadMedia(ctx, config.AuthConfig, config.Download)
+		}); err != nil {
+			fmt.Printf("Failed to download media: %v\n", err)
+			os.Exit(1)
+		}
+	case CommandReplies:
+		// Получение ответов в ветке обсуждения
+		if err := runMessageAction(func(ctx context.Context) error {
+			return GetReplies(ctx, config.AuthConfig, config.Replies)
+		}); err != nil {
+			fmt.Printf("Failed to get replies: %v\n", err)
+			os.Exit(1)
+		}
+	case CommandTopics:
+		// Получение списка тем форума
+		if err := runMessageAction(func(ctx context.Context) error {
+			return GetTopics(ctx, config.AuthConfig, config.Topics)
+		}); err != nil {
+			fmt.Printf("Failed to get topics: %v\n", err)
+			os.Exit(1)
+		}
+	case CommandRead:
+		// Отметка сообщений прочитанными
+		if err := runMessageAction(func(ctx context.Context) error {
+			return ReadHistory(ctx, config.AuthConfig, config.Read)
+		}); err != nil {
+			fmt.Printf("Failed to mark messages as read: %v\n", err)
+			os.Exit(1)
+		}
+	case CommandTyping:
+		// Статус набора в чате
+		if err := runMessageAction(func(ctx context.Context) error {
+			return SetTyping(ctx, config.AuthConfig, config.Typing)
+		}); err != nil {
+			fmt.Printf("Failed to set typing status: %v\n", err)
+			os.Exit(1)
+		}
+	case CommandStatus:
+		// Статус присутствия аккаунта
+		if err := runMessageAction(func(ctx context.Context) error {
+			return UpdateStatus(ctx, config.AuthConfig, config.Status)
+		}); err != nil {
+			fmt.Printf("Failed to update status: %v\n", err)
+			os.Exit(1)
+		}
 	case CommandHelp:
 		// Показать справку
 		PrintHelp()
@@ -77,31 +181,80 @@ func runChats(authConfig AuthConfig) error {
 }
 
 // runMessages выполняет получение сообщений из чата
-func runMessages(authConfig AuthConfig, chatID int64, limit int) error {
+func runMessages(authConfig AuthConfig, chatID int64, opts HistoryOptions, download DownloadOptions) error {
 	// Create context with signal handling
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
 	// Run messages retrieval
-	return GetMessages(ctx, authConfig, chatID, limit)
+	return GetMessages(ctx, authConfig, chatID, opts, download)
 }
 
 // runEvents выполняет отслеживание событий Telegram
-func runEvents(authConfig AuthConfig, timeout int) error {
-	// Создаем контекст с обработкой сигналов
-	baseCtx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+func runEvents(authConfig AuthConfig, opts EventsOptions) error {
+	// Создаем контекст с обработкой сигналов; таймаут применяется в GetEvents
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
-	// Если указан таймаут, создаем контекст с ограничением по времени
-	var ctx context.Context
-	if timeout > 0 {
-		var timeoutCancel context.CancelFunc
-		ctx, timeoutCancel = context.WithTimeout(baseCtx, time.Duration(timeout)*time.Second)
-		defer timeoutCancel()
-	} else {
-		ctx = baseCtx
+	stopMetrics, err := startMetricsServer(opts.MetricsAddr)
+	if err != nil {
+		return err
 	}
+	defer stopMetrics()
 
 	// Запускаем отслеживание событий
-	return GetEvents(ctx, authConfig, timeout)
+	return GetEvents(ctx, authConfig, opts)
+}
+
+// runDaemon запускает демон: SIGINT и SIGTERM останавливают его, SIGHUP перечитывает конфигурацию
+func runDaemon(config Config) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	// Адрес метрик не перечитывается по SIGHUP: сервер работает все время жизни демона
+	stopMetrics, err := startMetricsServer(config.Events.MetricsAddr)
+	if err != nil {
+		return err
+	}
+	defer stopMetrics()
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+
+	return RunDaemon(ctx, config, reload)
+}
+
+// runSearch выполняет поиск сообщений
+func runSearch(authConfig AuthConfig, opts SearchOptions) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	return SearchMessages(ctx, authConfig, opts)
+}
+
+// runSend выполняет отправку сообщения
+func runSend(authConfig AuthConfig, opts SendOptions) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	return SendMessage(ctx, authConfig, opts)
+}
+
+// runMessageAction выполняет команду управления сообщениями с обработкой сигналов
+func runMessageAction(action func(ctx context.Context) error) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	return action(ctx)
+}
+
+// printJSON выводит значение в stdout в формате JSON с отступами
+func printJSON(v interface{}) error {
+	jsonData, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to convert to JSON: %w", err)
+	}
+	fmt.Println(string(jsonData))
+	return nil
 }
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+)
+
+// EditOptions задает параметры редактирования сообщения
+type EditOptions struct {
+	Chat      string // Чат: ID или @username
+	ID        int    // ID редактируемого сообщения
+	Text      string // Новый текст; "-" означает чтение из stdin, пустое значение — из перенаправленного stdin
+	ParseMode string // Режим разметки: markdown или html
+	NoWebpage bool   // Не показывать превью ссылок
+}
+
+// DeleteOptions задает параметры удаления сообщений
+type DeleteOptions struct {
+	Chat   string // Чат: ID или @username
+	IDs    []int  // ID удаляемых сообщений
+	Revoke bool   // Удалить сообщения у всех участников
+}
+
+// PinOptions задает параметры закрепления сообщения
+type PinOptions struct {
+	Chat   string // Чат: ID или @username
+	ID     int    // ID сообщения
+	Unpin  bool   // Открепить вместо закрепления
+	Silent bool   // Не уведомлять участников
+}
+
+// ForwardOptions задает параметры пересылки сообщений
+type ForwardOptions struct {
+	FromChat   string // Исходный чат
+	ToChat     string // Чат назначения
+	IDs        []int  // ID пересылаемых сообщений
+	DropAuthor bool   // Переслать без указания автора
+	Silent     bool   // Отправить без звукового уведомления
+	TopicID    int    // ID темы форума в чате назначения
+}
+
+// DeleteResult содержит результат удаления сообщений
+type DeleteResult struct {
+	ChatID  int64 `json:"chat_id"`
+	IDs     []int `json:"ids"`
+	Revoke  bool  `json:"revoke,omitempty"`
+	Deleted int   `json:"deleted"`
+	Pts     int   `json:"pts,omitempty"`
+}
+
+// PinResult содержит результат закрепления или открепления сообщения
+type PinResult struct {
+	ChatID int64 `json:"chat_id"`
+	ID     int   `json:"id"`
+	Pinned bool  `json:"pinned"`
+	Silent bool  `json:"silent,omitempty"`
+}
+
+// ForwardResult содержит пересланные сообщения
+type ForwardResult struct {
+	FromChatID int64         `json:"from_chat_id"`
+	ToChatID   int64         `json:"to_chat_id"`
+	IDs        []int         `json:"ids"`
+	Messages   []MessageInfo `json:"messages"`
+	Count      int           `json:"count"`
+}
+
+// EditMessage редактирует текст сообщения и выводит его в формате JSON
+func EditMessage(ctx context.Context, config AuthConfig, opts EditOptions) error {
+	text, err := readMessageText(opts.Text)
+	if err != nil {
+		return err
+	}
+
+	message, entities, err := parseFormattedText(text, opts.ParseMode)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(message) == "" {
+		return fmt.Errorf("message text is empty")
+	}
+
+	return runAuthorized(ctx, config, func(ctx context.Context, client *telegram.Client) error {
+		peer, chatID, err := resolvePeer(ctx, client, opts.Chat)
+		if err != nil {
+			return fmt.Errorf("failed to resolve chat: %w", err)
+		}
+		entities = resolveMentions(ctx, client, entities)
+
+		fmt.Fprintf(os.Stderr, "Editing message %d in chat %d...\n", opts.ID, chatID)
+		updates, err := withFloodWait(ctx, func() (tg.UpdatesClass, error) {
+			return client.API().MessagesEditMessage(ctx, &tg.MessagesEditMessageRequest{
+				Peer:      peer,
+				ID:        opts.ID,
+				Message:   message,
+				Entities:  entities,
+				NoWebpage: opts.NoWebpage,
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("failed to edit message: %w", err)
+		}
+
+		edited, err := firstMessageFromUpdates(updates, chatID)
+		if err != nil {
+			return err
+		}
+		return printJSON(edited)
+	})
+}
+
+// DeleteMessages удаляет сообщения и выводит результат в формате JSON
+func DeleteMessages(ctx context.Context, config AuthConfig, opts DeleteOptions) error {
+	return runAuthorized(ctx, config, func(ctx context.Context, client *telegram.Client) error {
+		peer, chatID, err := resolvePeer(ctx, client, opts.Chat)
+		if err != nil {
+			return fmt.Errorf("failed to resolve chat: %w", err)
+		}
+
+		fmt.Fprintf(os.Stderr, "Deleting %d messages in chat %d...\n", len(opts.IDs), chatID)
+
+		// В каналах и супергруппах сообщения удаляются у всех через channels.deleteMessages,
+		// у которого нет параметра revoke, поэтому в ответе он не указывается
+		var affected *tg.MessagesAffectedMessages
+		channel, isChannel := inputChannelFromPeer(peer)
+		if isChannel {
+			affected, err = withFloodWait(ctx, func() (*tg.MessagesAffectedMessages, error) {
+				return client.API().ChannelsDeleteMessages(ctx, &tg.ChannelsDeleteMessagesRequest{
+					Channel: channel,
+					ID:      opts.IDs,
+				})
+			})
+		} else {
+			affected, err = withFloodWait(ctx, func() (*tg.MessagesAffectedMessages, error) {
+				return client.API().MessagesDeleteMessages(ctx, &tg.MessagesDeleteMessagesRequest{
+					Revoke: opts.Revoke,
+					ID:     opts.IDs,
+				})
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete messages: %w", err)
+		}
+
+		// pts_count считает события обновлений, а не сообщения, поэтому
+		// сообщаем число запрошенных ID
+		return printJSON(DeleteResult{
+			ChatID:  chatID,
+			IDs:     opts.IDs,
+			Revoke:  opts.Revoke && !isChannel,
+			Deleted: len(opts.IDs),
+			Pts:     affected.Pts,
+		})
+	})
+}
+
+// PinMessage закрепляет или открепляет сообщение и выводит результат в формате JSON
+func PinMessage(ctx context.Context, config AuthConfig, opts PinOptions) error {
+	return runAuthorized(ctx, config, func(ctx context.Context, client *telegram.Client) error {
+		peer, chatID, err := resolvePeer(ctx, client, opts.Chat)
+		if err != nil {
+			return fmt.Errorf("failed to resolve chat: %w", err)
+		}
+
+		action := "Pinning"
+		if opts.Unpin {
+			action = "Unpinning"
+		}
+		fmt.Fprintf(os.Stderr, "%s message %d in chat %d...\n", action, opts.ID, chatID)
+
+		if _, err := withFloodWait(ctx, func() (tg.UpdatesClass, error) {
+			return client.API().MessagesUpdatePinnedMessage(ctx, &tg.MessagesUpdatePinnedMessageRequest{
+				Peer:   peer,
+				ID:     opts.ID,
+				Unpin:  opts.Unpin,
+				Silent: opts.Silent,
+			})
+		}); err != nil {
+			return fmt.Errorf("failed to update pinned message: %w", err)
+		}
+
+		return printJSON(PinResult{
+			ChatID: chatID,
+			ID:     opts.ID,
+			Pinned: !opts.Unpin,
+			Silent: opts.Silent,
+		})
+	})
+}
+
+// ForwardMessages пересылает сообщения и выводит пересланные копии в формате JSON
+func ForwardMessages(ctx context.Context, config AuthConfig, opts ForwardOptions) error {
+	return runAuthorized(ctx, config, func(ctx context.Context, client *telegram.Client) error {
+		fromPeer, fromChatID, err := resolvePeer(ctx, client, opts.FromChat)
+		if err != nil {
+			return fmt.Errorf("failed to resolve source chat: %w", err)
+		}
+		toPeer, toChatID, err := resolvePeer(ctx, client, opts.ToChat)
+		if err != nil {
+			return fmt.Errorf("failed to resolve destination chat: %w", err)
+		}
+
+		// Для каждого сообщения нужен свой random_id
+		randomIDs := make([]int64, 0, len(opts.IDs))
+		for range opts.IDs {
+			id, err := client.RandInt64()
+			if err != nil {
+				return fmt.Errorf("failed to generate random ID: %w", err)
+			}
+			randomIDs = append(randomIDs, id)
+		}
+
+		fmt.Fprintf(os.Stderr, "Forwarding %d messages from chat %d to chat %d...\n", len(opts.IDs), fromChatID, toChatID)
+		updates, err := withFloodWait(ctx, func() (tg.UpdatesClass, error) {
+			return client.API().MessagesForwardMessages(ctx, &tg.MessagesForwardMessagesRequest{
+				FromPeer:   fromPeer,
+				ToPeer:     toPeer,
+				ID:         opts.IDs,
+				RandomID:   randomIDs,
+				DropAuthor: opts.DropAuthor,
+				Silent:     opts.Silent,
+				TopMsgID:   opts.TopicID,
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("failed to forward messages: %w", err)
+		}
+
+		forwarded, err := extractMessages(messagesFromUpdates(updates), toChatID)
+		if err != nil {
+			return fmt.Errorf("failed to extract messages: %w", err)
+		}
+
+		return printJSON(ForwardResult{
+			FromChatID: fromChatID,
+			ToChatID:   toChatID,
+			IDs:        opts.IDs,
+			Messages:   forwarded.Messages,
+			Count:      forwarded.Count,
+		})
+	})
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"github.com/gotd/td/tg"
+)
+
+// MediaInfo содержит подробную информацию о медиа сообщения
+type MediaInfo struct {
+	Type        string        `json:"type"`
+	FileName    string        `json:"file_name,omitempty"`
+	Size        int64         `json:"size,omitempty"`
+	MimeType    string        `json:"mime_type,omitempty"`
+	Duration    float64       `json:"duration,omitempty"`
+	Width       int           `json:"width,omitempty"`
+	Height      int           `json:"height,omitempty"`
+	FileID      int64         `json:"file_id,omitempty"`
+	AccessHash  int64         `json:"access_hash,omitempty"`
+	DCID        int           `json:"dc_id,omitempty"`
+	Title       string        `json:"title,omitempty"`
+	Performer   string        `json:"performer,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Emoji       string        `json:"emoji,omitempty"`
+	Value       int           `json:"value,omitempty"`
+	Currency    string        `json:"currency,omitempty"`
+	TotalAmount int64         `json:"total_amount,omitempty"`
+	Spoiler     bool          `json:"spoiler,omitempty"`
+	TTLSeconds  int           `json:"ttl_seconds,omitempty"`
+	WebPage     *WebPageInfo  `json:"web_page,omitempty"`
+	Poll        *PollInfo     `json:"poll,omitempty"`
+	Geo         *GeoInfo      `json:"geo,omitempty"`
+	Contact     *ContactInfo  `json:"contact,omitempty"`
+	Story       *StoryRefInfo `json:"story,omitempty"`
+}
+
+// WebPageInfo содержит превью ссылки
+type WebPageInfo struct {
+	URL         string `json:"url,omitempty"`
+	DisplayURL  string `json:"display_url,omitempty"`
+	Type        string `json:"type,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Author      string `json:"author,omitempty"`
+	Pending     bool   `json:"pending,omitempty"`
+}
+
+// PollInfo содержит вопрос, варианты ответа и результаты опроса
+type PollInfo struct {
+	ID             int64            `json:"id"`
+	Question       string           `json:"question"`
+	Options        []PollOptionInfo `json:"options"`
+	TotalVoters    int              `json:"total_voters,omitempty"`
+	Closed         bool             `json:"closed,omitempty"`
+	Quiz           bool             `json:"quiz,omitempty"`
+	MultipleChoice bool             `json:"multiple_choice,omitempty"`
+	PublicVoters   bool             `json:"public_voters,omitempty"`
+	CloseDate      int              `json:"close_date,omitempty"`
+	Solution       string           `json:"solution,omitempty"`
+}
+
+// PollOptionInfo содержит вариант ответа опроса и число голосов за него
+type PollOptionInfo struct {
+	Text    string `json:"text"`
+	Option  string `json:"option"`
+	Voters  int    `json:"voters,omitempty"`
+	Chosen  bool   `json:"chosen,omitempty"`
+	Correct bool   `json:"correct,omitempty"`
+}
+
+// GeoInfo содержит координаты точки, геопозиции в реальном времени или места
+type GeoInfo struct {
+	Latitude       float64 `json:"latitude"`
+	Longitude      float64 `json:"longitude"`
+	AccuracyRadius int     `json:"accuracy_radius,omitempty"`
+	Heading        int     `json:"heading,omitempty"`
+	Period         int     `json:"period,omitempty"`
+	Title          string  `json:"title,omitempty"`
+	Address        string  `json:"address,omitempty"`
+	Provider       string  `json:"provider,omitempty"`
+	VenueID        string  `json:"venue_id,omitempty"`
+	VenueType      string  `json:"venue_type,omitempty"`
+}
+
+// ContactInfo содержит отправленный контакт
+type ContactInfo struct {
+	PhoneNumber string `json:"phone_number,omitempty"`
+	FirstName   string `json:"first_name,omitempty"`
+	LastName    string `json:"last_name,omitempty"`
+	UserID      int64  `json:"user_id,omitempty"`
+	VCard       string `json:"vcard,omitempty"`
+}
+
+// StoryRefInfo содержит ссылку на пересланную историю
+type StoryRefInfo struct {
+	ChatID int64 `json:"chat_id,omitempty"`
+	ID     int   `json:"id"`
+}
+
+// extractMedia преобразует медиа сообщения в MediaInfo
+func extractMedia(media tg.MessageMediaClass) *MediaInfo {
+	switch m := media.(type) {
+	case *tg.MessageMediaPhoto:
+		info := &MediaInfo{Type: "photo", Spoiler: m.Spoiler, TTLSeconds: m.TTLSeconds}
+		if photo, ok := m.Photo.(*tg.Photo); ok {
+			best := largestPhotoSize(photo.Sizes)
+			info.FileID = photo.ID
+			info.AccessHash = photo.AccessHash
+			info.DCID = photo.DCID
+			info.Size = best.size
+			info.Width = best.w
+			info.Height = best.h
+			info.MimeType = "image/jpeg"
+		}
+		return info
+
+	case *tg.MessageMediaDocument:
+		doc, ok := m.Document.(*tg.Document)
+		if !ok {
+			return &MediaInfo{Type: "document", Spoiler: m.Spoiler, TTLSeconds: m.TTLSeconds}
+		}
+		info := documentMedia(doc, m)
+		info.Spoiler = m.Spoiler
+		info.TTLSeconds = m.TTLSeconds
+		return info
+
+	case *tg.MessageMediaWebPage:
+		info := &MediaInfo{Type: "webpage", WebPage: &WebPageInfo{}}
+		switch page := m.Webpage.(type) {
+		case *tg.WebPage:
+			info.WebPage = &WebPageInfo{
+				URL:         page.URL,
+				DisplayURL:  page.DisplayURL,
+				Type:        page.Type,
+				SiteName:    page.SiteName,
+				Title:       page.Title,
+				Description: page.Description,
+				Author:      page.Author,
+			}
+		case *tg.WebPagePending:
+			info.WebPage = &WebPageInfo{URL: page.URL, Pending: true}
+		}
+		return info
+
+	case *tg.MessageMediaPoll:
+		return &MediaInfo{Type: "poll", Poll: extractPoll(m)}
+
+	case *tg.MessageMediaGeo:
+		return &MediaInfo{Type: "geo", Geo: geoPointInfo(m.Geo)}
+
+	case *tg.MessageMediaGeoLive:
+		geo := geoPointInfo(m.Geo)
+		geo.Heading = m.Heading
+		geo.Period = m.Period
+		return &MediaInfo{Type: "live_location", Geo: geo}
+
+	case *tg.MessageMediaVenue:
+		geo := geoPointInfo(m.Geo)
+		geo.Title = m.Title
+		geo.Address = m.Address
+		geo.Provider = m.Provider
+		geo.VenueID = m.VenueID
+		geo.VenueType = m.VenueType
+		return &MediaInfo{Type: "venue", Title: m.Title, Geo: geo}
+
+	case *tg.MessageMediaContact:
+		return &MediaInfo{
+			Type: "contact",
+			Contact: &ContactInfo{
+				PhoneNumber: m.PhoneNumber,
+				FirstName:   m.FirstName,
+				LastName:    m.LastName,
+				UserID:      m.UserID,
+				VCard:       m.Vcard,
+			},
+		}
+
+	case *tg.MessageMediaDice:
+		return &MediaInfo{Type: "dice", Emoji: m.Emoticon, Value: m.Value}
+
+	case *tg.MessageMediaGame:
+		return &MediaInfo{Type: "game", Title: m.Game.Title, Description: m.Game.Description}
+
+	case *tg.MessageMediaInvoice:
+		return &MediaInfo{
+			Type:        "invoice",
+			Title:       m.Title,
+			Description: m.Description,
+			Currency:    m.Currency,
+			TotalAmount: m.TotalAmount,
+		}
+
+	case *tg.MessageMediaStory:
+		return &MediaInfo{Type: "story", Story: &StoryRefInfo{ChatID: peerToChatID(m.Peer), ID: m.ID}}
+
+	case *tg.MessageMediaGiveaway:
+		return &MediaInfo{Type: "giveaway", Description: m.PrizeDescription, Value: m.Quantity}
+
+	case *tg.MessageMediaGiveawayResults:
+		return &MediaInfo{Type: "giveaway_results", Description: m.PrizeDescription, Value: m.WinnersCount}
+
+	case *tg.MessageMediaUnsupported:
+		return &MediaInfo{Type: "unsupported"}
+	}
+	return nil
+}
+
+// documentMedia определяет вид документа по его атрибутам и заполняет метаданные
+func documentMedia(doc *tg.Document, m *tg.MessageMediaDocument) *MediaInfo {
+	info := &MediaInfo{
+		Type:       "document",
+		Size:       doc.Size,
+		MimeType:   doc.MimeType,
+		FileID:     doc.ID,
+		AccessHash: doc.AccessHash,
+		DCID:       doc.DCID,
+	}
+
+	var isSticker, isAnimated, isVideo, isRound, isAudio, isVoice bool
+	for _, attr := range doc.Attributes {
+		switch a := attr.(type) {
+		case *tg.DocumentAttributeFilename:
+			info.FileName = a.FileName
+		case *tg.DocumentAttributeImageSize:
+			info.Width, info.Height = a.W, a.H
+		case *tg.DocumentAttributeAnimated:
+			isAnimated = true
+		case *tg.DocumentAttributeSticker:
+			isSticker = true
+			info.Emoji = a.Alt
+		case *tg.DocumentAttributeVideo:
+			isVideo = true
+			isRound = a.RoundMessage
+			info.Duration = a.Duration
+			info.Width, info.Height = a.W, a.H
+		case *tg.DocumentAttributeAudio:
+			isAudio = true
+			isVoice = a.Voice
+			info.Duration = float64(a.Duration)
+			info.Title = a.Title
+			info.Performer = a.Performer
+		case *tg.DocumentAttributeCustomEmoji:
+			isSticker = true
+			info.Emoji = a.Alt
+		}
+	}
+
+	switch {
+	case isSticker && doc.MimeType == "application/x-tgsticker":
+		info.Type = "animated_sticker"
+	case isSticker && doc.MimeType == "video/webm":
+		info.Type = "video_sticker"
+	case isSticker:
+		info.Type = "sticker"
+	case isAnimated:
+		info.Type = "animation"
+	case isRound || m.Round:
+		info.Type = "round_video"
+	case isVideo || m.Video:
+		info.Type = "video"
+	case isVoice || m.Voice:
+		info.Type = "voice"
+	case isAudio:
+		info.Type = "audio"
+	}
+	return info
+}
+
+// extractPoll преобразует опрос и его результаты
+func extractPoll(m *tg.MessageMediaPoll) *PollInfo {
+	poll := &PollInfo{
+		ID:             m.Poll.ID,
+		Question:       m.Poll.Question,
+		Options:        make([]PollOptionInfo, 0, len(m.Poll.Answers)),
+		Closed:         m.Poll.Closed,
+		Quiz:           m.Poll.Quiz,
+		MultipleChoice: m.Poll.MultipleChoice,
+		PublicVoters:   m.Poll.PublicVoters,
+		CloseDate:      m.Poll.CloseDate,
+		TotalVoters:    m.Results.TotalVoters,
+		Solution:       m.Results.Solution,
+	}
+
+	// Результаты сопоставляются с вариантами по полю option
+	voters := make(map[string]tg.PollAnswerVoters, len(m.Results.Results))
+	for _, r := range m.Results.Results {
+		voters[string(r.Option)] = r
+	}
+	for _, answer := range m.Poll.Answers {
+		option := PollOptionInfo{Text: answer.Text, Option: string(answer.Option)}
+		if r, ok := voters[string(answer.Option)]; ok {
+			option.Voters = r.Voters
+			option.Chosen = r.Chosen
+			option.Correct = r.Correct
+		}
+		poll.Options = append(poll.Options, option)
+	}
+	return poll
+}
+
+// geoPointInfo преобразует координаты точки
+func geoPointInfo(point tg.GeoPointClass) *GeoInfo {
+	geo, ok := point.(*tg.GeoPoint)
+	if !ok {
+		return &GeoInfo{}
+	}
+	return &GeoInfo{
+		Latitude:       geo.Lat,
+		Longitude:      geo.Long,
+		AccuracyRadius: geo.AccuracyRadius,
+	}
+}
+
+// photoSize описывает вариант размера фотографии
+type photoSize struct {
+	sizeType string
+	size     int64
+	w, h     int
+}
+
+// largestPhotoSize возвращает самый большой вариант фотографии
+func largestPhotoSize(sizes []tg.PhotoSizeClass) photoSize {
+	var best photoSize
+	for _, s := range sizes {
+		switch size := s.(type) {
+		case *tg.PhotoSize:
+			if int64(size.Size) >= best.size {
+				best = photoSize{sizeType: size.Type, size: int64(size.Size), w: size.W, h: size.H}
+			}
+		case *tg.PhotoSizeProgressive:
+			if len(size.Sizes) > 0 && int64(size.Sizes[len(size.Sizes)-1]) >= best.size {
+				best = photoSize{sizeType: size.Type, size: int64(size.Sizes[len(size.Sizes)-1]), w: size.W, h: size.H}
+			}
+		}
+	}
+	return best
+}
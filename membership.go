@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// ChatActionInfo описывает изменение состава или прав участников чата
+type ChatActionInfo struct {
+	ActorID    int64   `json:"actor_id,omitempty"`   // Кто выполнил действие
+	UserIDs    []int64 `json:"user_ids,omitempty"`   // Кого оно затронуло
+	InviterID  int64   `json:"inviter_id,omitempty"` // Кто пригласил участника
+	InviteLink string  `json:"invite_link,omitempty"`
+	About      string  `json:"about,omitempty"` // Сообщение заявки на вступление
+	PrevStatus string  `json:"prev_status,omitempty"`
+	NewStatus  string  `json:"new_status,omitempty"`
+}
+
+// ReadEventInfo описывает прочтение сообщений
+type ReadEventInfo struct {
+	Outbox           bool `json:"outbox"` // true: собеседник прочитал наши сообщения
+	MaxID            int  `json:"max_id"`
+	StillUnreadCount int  `json:"still_unread_count,omitempty"`
+}
+
+// registerChatActionHandlers подключает обработчики изменений участников и прочтений
+func registerChatActionHandlers(dispatcher tg.UpdateDispatcher, s *eventStream) {
+	// Изменение участника обычной группы
+	dispatcher.OnChatParticipant(func(ctx context.Context, entities tg.Entities, update *tg.UpdateChatParticipant) error {
+		prev, next := chatParticipantStatus(update.PrevParticipant), chatParticipantStatus(update.NewParticipant)
+		action := &ChatActionInfo{
+			ActorID:    update.ActorID,
+			UserIDs:    []int64{update.UserID},
+			InviteLink: inviteLink(update.Invite),
+			PrevStatus: prev,
+			NewStatus:  next,
+		}
+		if prev == "" {
+			action.InviterID = chatInviterID(update.NewParticipant)
+		}
+		return s.handleChatActionEvent(ctx, &tg.PeerChat{ChatID: update.ChatID}, update.UserID,
+			participantAction(update.ActorID, update.UserID, prev, next, update.Invite != nil), action, entities)
+	})
+
+	// Изменение участника супергруппы или канала
+	dispatcher.OnChannelParticipant(func(ctx context.Context, entities tg.Entities, update *tg.UpdateChannelParticipant) error {
+		prev, next := channelParticipantStatus(update.PrevParticipant), channelParticipantStatus(update.NewParticipant)
+		action := &ChatActionInfo{
+			ActorID:    update.ActorID,
+			UserIDs:    []int64{update.UserID},
+			InviteLink: inviteLink(update.Invite),
+			PrevStatus: prev,
+			NewStatus:  next,
+		}
+		if !isMemberStatus(prev) {
+			action.InviterID = channelInviterID(update.NewParticipant)
+		}
+		return s.handleChatActionEvent(ctx, &tg.PeerChannel{ChannelID: update.ChannelID}, update.UserID,
+			participantAction(update.ActorID, update.UserID, prev, next, update.Invite != nil), action, entities)
+	})
+
+	// Добавление участника в обычную группу
+	dispatcher.OnChatParticipantAdd(func(ctx context.Context, entities tg.Entities, update *tg.UpdateChatParticipantAdd) error {
+		return s.handleChatActionEvent(ctx, &tg.PeerChat{ChatID: update.ChatID}, update.UserID, "added", &ChatActionInfo{
+			ActorID:   update.InviterID,
+			UserIDs:   []int64{update.UserID},
+			InviterID: update.InviterID,
+		}, entities)
+	})
+
+	// Удаление участника из обычной группы
+	dispatcher.OnChatParticipantDelete(func(ctx context.Context, entities tg.Entities, update *tg.UpdateChatParticipantDelete) error {
+		return s.handleChatActionEvent(ctx, &tg.PeerChat{ChatID: update.ChatID}, update.UserID, "removed", &ChatActionInfo{
+			UserIDs: []int64{update.UserID},
+		}, entities)
+	})
+
+	// Заявка на вступление по ссылке с одобрением
+	dispatcher.OnBotChatInviteRequester(func(ctx context.Context, entities tg.Entities, update *tg.UpdateBotChatInviteRequester) error {
+		return s.handleChatActionEvent(ctx, update.Peer, update.UserID, "join_request", &ChatActionInfo{
+			UserIDs:    []int64{update.UserID},
+			InviteLink: inviteLink(update.Invite),
+			About:      update.About,
+		}, entities)
+	})
+
+	// Прочтение входящих сообщений (нами на другом устройстве)
+	dispatcher.OnReadHistoryInbox(func(ctx context.Context, entities tg.Entities, update *tg.UpdateReadHistoryInbox) error {
+		return s.handleReadEvent(ctx, update.Peer, ReadEventInfo{MaxID: update.MaxID, StillUnreadCount: update.StillUnreadCount}, entities)
+	})
+
+	// Прочтение наших сообщений собеседником
+	dispatcher.OnReadHistoryOutbox(func(ctx context.Context, entities tg.Entities, update *tg.UpdateReadHistoryOutbox) error {
+		return s.handleReadEvent(ctx, update.Peer, ReadEventInfo{Outbox: true, MaxID: update.MaxID}, entities)
+	})
+
+	// То же для супергрупп и каналов
+	dispatcher.OnReadChannelInbox(func(ctx context.Context, entities tg.Entities, update *tg.UpdateReadChannelInbox) error {
+		return s.handleReadEvent(ctx, &tg.PeerChannel{ChannelID: update.ChannelID},
+			ReadEventInfo{MaxID: update.MaxID, StillUnreadCount: update.StillUnreadCount}, entities)
+	})
+	dispatcher.OnReadChannelOutbox(func(ctx context.Context, entities tg.Entities, update *tg.UpdateReadChannelOutbox) error {
+		return s.handleReadEvent(ctx, &tg.PeerChannel{ChannelID: update.ChannelID}, ReadEventInfo{Outbox: true, MaxID: update.MaxID}, entities)
+	})
+}
+
+// handleChatActionEvent выводит событие действия в чате
+func (s *eventStream) handleChatActionEvent(ctx context.Context, peer tg.PeerClass, userID int64, name string, action *ChatActionInfo, entities tg.Entities) error {
+	event := EventInfo{
+		Type:       EventChatAction,
+		Time:       time.Now().Unix(),
+		Action:     name,
+		ChatAction: action,
+	}
+	s.peers.lookup(entities, func(userMap map[int64]tg.UserClass, chatMap map[int64]tg.ChatClass) {
+		fillEventChat(&event, peer, userMap, chatMap)
+		fillEventUser(&event, userID, userMap)
+	})
+	return s.emit(ctx, event)
+}
+
+// handleServiceEvent выводит событие действия в чате по служебному сообщению.
+// Изменения состава приходят и служебным сообщением, и обновлением участника
+// (UpdateChatParticipantAdd, UpdateChannelParticipant), поэтому могут выводиться
+// дважды: у события по служебному сообщению есть message_id, а action — имя
+// действия сообщения (chat_add_user), у второго — имя изменения (added)
+func (s *eventStream) handleServiceEvent(ctx context.Context, msg *tg.MessageService, entities tg.Entities) error {
+	event := EventInfo{
+		Type:      EventChatAction,
+		Time:      time.Now().Unix(),
+		MessageID: msg.ID,
+	}
+	s.peers.lookup(entities, func(userMap map[int64]tg.UserClass, chatMap map[int64]tg.ChatClass) {
+		fillEventChat(&event, msg.PeerID, userMap, chatMap)
+		info, _ := extractMessage(msg, userMap, chatMap)
+		event.Details = &info
+		event.TopicID = info.TopicID
+
+		// Как и у обновлений участников: actor_id — инициатор, user_id — затронутый пользователь
+		action := &ChatActionInfo{}
+		if fromUser, ok := msg.FromID.(*tg.PeerUser); ok {
+			action.ActorID = fromUser.UserID
+		}
+		if info.Action != nil {
+			event.Action = info.Action.Action
+			action.UserIDs = info.Action.UserIDs
+			action.InviterID = info.Action.InviterID
+		}
+		event.ChatAction = action
+		if len(action.UserIDs) > 0 {
+			fillEventUser(&event, action.UserIDs[0], userMap)
+		}
+	})
+	return s.emit(ctx, event)
+}
+
+// handleReadEvent выводит событие прочтения сообщений
+func (s *eventStream) handleReadEvent(ctx context.Context, peer tg.PeerClass, read ReadEventInfo, entities tg.Entities) error {
+	event := EventInfo{
+		Type:      EventRead,
+		Time:      time.Now().Unix(),
+		MessageID: read.MaxID,
+		Read:      &read,
+	}
+	s.peers.lookup(entities, func(userMap map[int64]tg.UserClass, chatMap map[int64]tg.ChatClass) {
+		fillEventChat(&event, peer, userMap, chatMap)
+	})
+	return s.emit(ctx, event)
+}
+
+// participantAction определяет, что произошло с участником, по его статусам до и после
+func participantAction(actorID, userID int64, prev, next string, viaInvite bool) string {
+	self := actorID == 0 || actorID == userID
+	switch {
+	case prev == "" && next == "":
+		return "participant_updated"
+	case isMemberStatus(next) && !isMemberStatus(prev):
+		switch {
+		case prev == "banned":
+			return "unbanned"
+		case viaInvite:
+			return "joined_by_link"
+		case self:
+			return "joined"
+		}
+		return "added"
+	case prev == "banned" && next == "":
+		// Снятие ограничений с исключенного пользователя убирает его из черного списка
+		return "unbanned"
+	case next == "" || next == "left":
+		if self {
+			return "left"
+		}
+		return "kicked"
+	case next == "banned":
+		return "banned"
+	case next == "restricted":
+		if prev == "restricted" {
+			return "restriction_changed"
+		}
+		return "restricted"
+	case isAdminStatus(next) && !isAdminStatus(prev):
+		return "promoted"
+	case isAdminStatus(prev) && !isAdminStatus(next):
+		return "demoted"
+	case next == "admin" && prev == "admin":
+		return "admin_rights_changed"
+	case prev == "restricted" && next == "member":
+		return "unrestricted"
+	}
+	return "participant_updated"
+}
+
+// isMemberStatus сообщает, состоит ли участник в чате
+func isMemberStatus(status string) bool {
+	switch status {
+	case "member", "admin", "creator", "restricted":
+		return true
+	}
+	return false
+}
+
+// isAdminStatus сообщает, является ли участник администратором
+func isAdminStatus(status string) bool {
+	return status == "admin" || status == "creator"
+}
+
+// chatParticipantStatus возвращает статус участника обычной группы; пустая строка — не участник
+func chatParticipantStatus(participant tg.ChatParticipantClass) string {
+	switch participant.(type) {
+	case *tg.ChatParticipant:
+		return "member"
+	case *tg.ChatParticipantAdmin:
+		return "admin"
+	case *tg.ChatParticipantCreator:
+		return "creator"
+	}
+	return ""
+}
+
+// channelParticipantStatus возвращает статус участника супергруппы или канала
+func channelParticipantStatus(participant tg.ChannelParticipantClass) string {
+	switch p := participant.(type) {
+	case *tg.ChannelParticipant, *tg.ChannelParticipantSelf:
+		return "member"
+	case *tg.ChannelParticipantAdmin:
+		return "admin"
+	case *tg.ChannelParticipantCreator:
+		return "creator"
+	case *tg.ChannelParticipantLeft:
+		return "left"
+	case *tg.ChannelParticipantBanned:
+		// Без права читать сообщения участник фактически исключен
+		if p.Left || p.BannedRights.ViewMessages {
+			return "banned"
+		}
+		return "restricted"
+	}
+	return ""
+}
+
+// chatInviterID возвращает, кто пригласил участника обычной группы
+func chatInviterID(participant tg.ChatParticipantClass) int64 {
+	switch p := participant.(type) {
+	case *tg.ChatParticipant:
+		return p.InviterID
+	case *tg.ChatParticipantAdmin:
+		return p.InviterID
+	}
+	return 0
+}
+
+// channelInviterID возвращает, кто пригласил участника супергруппы или канала
+func channelInviterID(participant tg.ChannelParticipantClass) int64 {
+	switch p := participant.(type) {
+	case *tg.ChannelParticipantSelf:
+		return p.InviterID
+	case *tg.ChannelParticipantAdmin:
+		return p.InviterID
+	}
+	return 0
+}
+
+// inviteLink возвращает ссылку приглашения, по которой вступил участник
+func inviteLink(invite tg.ExportedChatInviteClass) string {
+	if exported, ok := invite.(*tg.ChatInviteExported); ok {
+		return exported.Link
+	}
+	return ""
+}
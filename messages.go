@@ -3,17 +3,21 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/gotd/td/telegram"
-	"github.com/gotd/td/telegram/auth"
 	"github.com/gotd/td/tg"
 )
 
-// MessageSender содержит информацию об отправителе сообщения
+// MessageSender содержит информацию об отправителе сообщения. ID — идентификатор
+// пользователя или чата в MTProto; для групп и каналов ChatID дублирует его в формате
+// Bot API, как chat_id: у групп -ID, у каналов и супергрупп -100ID
 type MessageSender struct {
 	ID        int64  `json:"id"`
+	ChatID    int64  `json:"chat_id,omitempty"`
 	Type      string `json:"type"`
 	Username  string `json:"username,omitempty"`
 	FirstName string `json:"first_name,omitempty"`
@@ -23,29 +27,50 @@ type MessageSender struct {
 
 // MessageEntity представляет форматирование в тексте сообщения
 type MessageEntity struct {
-	Type     string `json:"type"`
-	Offset   int    `json:"offset"`
-	Length   int    `json:"length"`
-	URL      string `json:"url,omitempty"`
-	UserID   int64  `json:"user_id,omitempty"`
-	Language string `json:"language,omitempty"`
+	Type          string `json:"type"`
+	Offset        int    `json:"offset"`
+	Length        int    `json:"length"`
+	URL           string `json:"url,omitempty"`
+	UserID        int64  `json:"user_id,omitempty"`
+	Language      string `json:"language,omitempty"`
+	CustomEmojiID int64  `json:"custom_emoji_id,omitempty"`
 }
 
 // MessageInfo содержит информацию о сообщении
 type MessageInfo struct {
-	ID           int             `json:"id"`
-	Date         int             `json:"date"`
-	Text         string          `json:"text,omitempty"`
-	Type         string          `json:"type"`
-	IsOutgoing   bool            `json:"is_outgoing,omitempty"`
-	IsMentioned  bool            `json:"is_mentioned,omitempty"`
-	MediaType    string          `json:"media_type,omitempty"`
-	Sender       *MessageSender  `json:"sender,omitempty"`
-	ForwardFrom  *MessageSender  `json:"forward_from,omitempty"`
-	ReplyToMsgID int             `json:"reply_to_msg_id,omitempty"`
-	Entities     []MessageEntity `json:"entities,omitempty"`
-	Views        int             `json:"views,omitempty"`
-	EditDate     int             `json:"edit_date,omitempty"`
+	ID           int              `json:"id"`
+	ChatID       int64            `json:"chat_id,omitempty"`
+	Date         int              `json:"date"`
+	Text         string           `json:"text,omitempty"`
+	Type         string           `json:"type"`
+	IsOutgoing   bool             `json:"is_outgoing,omitempty"`
+	IsMentioned  bool             `json:"is_mentioned,omitempty"`
+	MediaType    string           `json:"media_type,omitempty"`
+	Media        *MediaInfo       `json:"media,omitempty"`
+	Sender       *MessageSender   `json:"sender,omitempty"`
+	SenderChat   *MessageSender   `json:"sender_chat,omitempty"`
+	ForwardFrom  *MessageSender   `json:"forward_from,omitempty"`
+	Forward      *ForwardInfo     `json:"forward,omitempty"`
+	ReplyToMsgID int              `json:"reply_to_msg_id,omitempty"`
+	ReplyToTopID int              `json:"reply_to_top_id,omitempty"`
+	TopicID      int              `json:"topic_id,omitempty"`
+	Entities     []MessageEntity  `json:"entities,omitempty"`
+	Rendered     string           `json:"rendered,omitempty"`
+	Views        int              `json:"views,omitempty"`
+	Forwards     int              `json:"forwards,omitempty"`
+	Replies      int              `json:"replies,omitempty"`
+	Reactions    []ReactionInfo   `json:"reactions,omitempty"`
+	ReplyMarkup  *ReplyMarkupInfo `json:"reply_markup,omitempty"`
+	PostAuthor   string           `json:"post_author,omitempty"`
+	ViaBotID     int64            `json:"via_bot_id,omitempty"`
+	GroupedID    int64            `json:"grouped_id,omitempty"`
+	TTLPeriod    int              `json:"ttl_period,omitempty"`
+	Pinned       bool             `json:"pinned,omitempty"`
+	NoForwards   bool             `json:"noforwards,omitempty"`
+	EditDate     int              `json:"edit_date,omitempty"`
+	Action       *ServiceAction   `json:"action,omitempty"`
+	LocalPath    string           `json:"local_path,omitempty"`
+	LocalSize    int64            `json:"local_size,omitempty"`
 }
 
 // MessagesResponse содержит список сообщений для вывода в JSON
@@ -56,98 +81,125 @@ type MessagesResponse struct {
 }
 
 // GetMessages получает сообщения из указанного чата
-func GetMessages(ctx context.Context, config AuthConfig, chatID int64, limit int) error {
-	// Create client
-	client := telegram.NewClient(config.AppID, config.AppHash, telegram.Options{
-		SessionStorage: &telegram.FileSessionStorage{
-			Path: config.SessionFile,
-		},
-	})
+func GetMessages(ctx context.Context, config AuthConfig, chatID int64, opts HistoryOptions, download DownloadOptions) error {
+	// Полная выгрузка истории и скачивание медиа могут занимать сколько угодно времени
+	if !opts.All && download.Dir == "" {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 2*time.Minute)
+		defer cancel()
+	}
 
-	// Канал для передачи результата или ошибки
-	resultCh := make(chan *MessagesResponse, 1)
-	errCh := make(chan error, 1)
-
-	// Запускаем клиент
-	go func() {
-		err := client.Run(ctx, func(ctx context.Context) error {
-			// Авторизируемся при необходимости
-			flow := auth.NewFlow(
-				auth.CodeOnly(config.Phone, &telegramCodeAuth{}),
-				auth.SendCodeOptions{},
-			)
-
-			// Выполняем авторизацию если нужно
-			fmt.Println("Checking authorization...")
-			if err := client.Auth().IfNecessary(ctx, flow); err != nil {
-				return fmt.Errorf("authentication error: %w", err)
-			}
+	err := runAuthorized(ctx, config, func(ctx context.Context, client *telegram.Client) error {
+		// Создаем InputPeer из chatID
+		peer, err := getInputPeerFromChatID(ctx, client, chatID)
+		if err != nil {
+			return fmt.Errorf("failed to get input peer: %w", err)
+		}
 
-			// Проверяем авторизацию
-			status, err := client.Auth().Status(ctx)
-			if err != nil {
-				return fmt.Errorf("failed to get auth status: %w", err)
+		fmt.Fprintf(os.Stderr, "Getting messages from chat ID %d...\n", chatID)
+
+		// Исходные сообщения текущей страницы нужны для скачивания медиа
+		rawByID := make(map[int]*tg.Message)
+
+		// Запрос одной страницы истории
+		fetch := func(ctx context.Context, offsetID, offsetDate, limit int) (tg.MessagesMessagesClass, error) {
+			var history tg.MessagesMessagesClass
+			var err error
+			if opts.TopicID != 0 {
+				// История темы форума запрашивается как ответы на ее первое сообщение
+				history, err = client.API().MessagesGetReplies(ctx, &tg.MessagesGetRepliesRequest{
+					Peer:       peer,
+					MsgID:      opts.TopicID,
+					OffsetID:   offsetID,
+					OffsetDate: offsetDate,
+					Limit:      limit,
+					MinID:      opts.MinID,
+					MaxID:      opts.MaxID,
+				})
+			} else {
+				history, err = client.API().MessagesGetHistory(ctx, &tg.MessagesGetHistoryRequest{
+					Peer:       peer,
+					OffsetID:   offsetID,
+					OffsetDate: offsetDate,
+					Limit:      limit,
+					MinID:      opts.MinID,
+					MaxID:      opts.MaxID,
+				})
 			}
-
-			if !status.Authorized {
-				return fmt.Errorf("not authorized")
+			if err != nil || download.Dir == "" {
+				return history, err
 			}
 
-			// Создаем InputPeer из chatID
-			peer, err := getInputPeerFromChatID(ctx, client, chatID)
+			raw, err := historyMessages(history)
 			if err != nil {
-				return fmt.Errorf("failed to get input peer: %w", err)
+				return nil, err
 			}
-
-			fmt.Printf("Getting messages from chat ID %d...\n", chatID)
-
-			// Получаем сообщения из чата
-			history, err := client.API().MessagesGetHistory(ctx, &tg.MessagesGetHistoryRequest{
-				Peer:  peer,
-				Limit: limit,
-			})
-			if err != nil {
-				return fmt.Errorf("failed to get messages: %w", err)
+			rawByID = make(map[int]*tg.Message, len(raw))
+			for _, m := range raw {
+				if msg, ok := m.(*tg.Message); ok {
+					rawByID[msg.ID] = msg
+				}
 			}
+			return history, nil
+		}
 
-			// Преобразуем полученные данные
-			messages, err := extractMessages(history, chatID)
-			if err != nil {
-				return fmt.Errorf("failed to extract messages: %w", err)
+		// Скачиваем медиа перед выводом сообщения, если указан каталог
+		var downloader *mediaDownloader
+		if download.Dir != "" {
+			downloader = newMediaDownloader(client.API(), download.Dir, download.Threads, download.NameTemplate)
+		}
+		withMedia := func(emit func(MessageInfo) error) func(MessageInfo) error {
+			if downloader == nil {
+				return emit
+			}
+			return func(msg MessageInfo) error {
+				if raw, ok := rawByID[msg.ID]; ok {
+					if err := downloader.download(ctx, chatID, raw, &msg); err != nil {
+						return err
+					}
+				}
+				return emit(msg)
 			}
+		}
 
-			// Отправляем результат
-			resultCh <- messages
-			return nil
-		})
+		// При выгрузке всей истории пишем сообщения потоком в NDJSON
+		if opts.All {
+			encoder := json.NewEncoder(os.Stdout)
+			return walkHistory(ctx, fetch, opts, chatID, withMedia(func(msg MessageInfo) error {
+				return encoder.Encode(msg)
+			}))
+		}
 
-		if err != nil {
-			errCh <- err
+		// Собираем сообщения в один ответ
+		messages := &MessagesResponse{
+			Messages: make([]MessageInfo, 0, opts.Limit),
+			ChatID:   chatID,
+		}
+		if err := walkHistory(ctx, fetch, opts, chatID, withMedia(func(msg MessageInfo) error {
+			messages.Messages = append(messages.Messages, msg)
+			return nil
+		})); err != nil {
+			return err
 		}
-	}()
-
-	// Ждем или результат, или ошибку, или таймаут
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case err := <-errCh:
-		return err
-	case result := <-resultCh:
+		messages.Count = len(messages.Messages)
+
 		// Выводим результат в формате JSON
-		jsonData, err := json.MarshalIndent(result, "", "  ")
+		jsonData, err := json.MarshalIndent(messages, "", "  ")
 		if err != nil {
 			return fmt.Errorf("failed to convert to JSON: %w", err)
 		}
 		fmt.Println(string(jsonData))
 		return nil
-	case <-time.After(2 * time.Minute): // Таймаут 2 минуты
+	})
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
 		return fmt.Errorf("operation timed out")
 	}
+	return err
 }
 
 // getInputPeerFromChatID преобразует ID чата в InputPeer
 func getInputPeerFromChatID(ctx context.Context, client *telegram.Client, chatID int64) (tg.InputPeerClass, error) {
-	fmt.Printf("Looking for peer with ID: %d\n", chatID)
+	fmt.Fprintf(os.Stderr, "Looking for peer with ID: %d\n", chatID)
 
 	// Перед запуском API, попробуем определить, какой тип чата это может быть
 	// и сконвертировать ID в правильный формат для поиска
@@ -161,20 +213,20 @@ func getInputPeerFromChatID(ctx context.Context, client *telegram.Client, chatID
 			// Извлекаем ID канала из ID с префиксом
 			rawID = -(chatID + 1000000000000)
 			isChannel = true
-			fmt.Printf("Detected channel/supergroup, using internal ID: %d\n", rawID)
+			fmt.Fprintf(os.Stderr, "Detected channel/supergroup, using internal ID: %d\n", rawID)
 		} else {
 			// Обычный чат
 			rawID = -chatID
-			fmt.Printf("Detected regular chat, using internal ID: %d\n", rawID)
+			fmt.Fprintf(os.Stderr, "Detected regular chat, using internal ID: %d\n", rawID)
 		}
 	} else {
 		// Если ID положительный (пользователь)
 		rawID = chatID
-		fmt.Printf("Detected user, using ID: %d\n", rawID)
+		fmt.Fprintf(os.Stderr, "Detected user, using ID: %d\n", rawID)
 	}
 
 	// Получаем список диалогов для поиска информации о чатах и пользователях
-	fmt.Println("Looking for peer in dialogs...")
+	fmt.Fprintln(os.Stderr, "Looking for peer in dialogs...")
 
 	// Получаем список диалогов
 	dialogsClass, err := client.API().MessagesGetDialogs(ctx, &tg.MessagesGetDialogsRequest{
@@ -200,16 +252,16 @@ func getInputPeerFromChatID(ctx context.Context, client *telegram.Client, chatID
 	}
 
 	// Выводим информацию о найденных чатах для отладки
-	fmt.Printf("Found %d chats and %d users\n", len(chats), len(users))
+	fmt.Fprintf(os.Stderr, "Found %d chats and %d users\n", len(chats), len(users))
 
 	// Если ID положительный, это пользователь
 	if chatID > 0 {
 		// Ищем пользователя по ID
 		for _, user := range users {
 			if u, ok := user.(*tg.User); ok {
-				fmt.Printf("Checking user ID: %d\n", u.ID)
+				fmt.Fprintf(os.Stderr, "Checking user ID: %d\n", u.ID)
 				if u.ID == rawID {
-					fmt.Printf("Found user with ID %d, access hash: %d\n", u.ID, u.AccessHash)
+					fmt.Fprintf(os.Stderr, "Found user with ID %d, access hash: %d\n", u.ID, u.AccessHash)
 					return &tg.InputPeerUser{
 						UserID:     u.ID,
 						AccessHash: u.AccessHash,
@@ -222,7 +274,7 @@ func getInputPeerFromChatID(ctx context.Context, client *telegram.Client, chatID
 		// Но сначала проверим, что мы ищем именно ваш ID
 		self, err := client.Self(ctx)
 		if err == nil && self.ID == rawID {
-			fmt.Println("Using InputPeerSelf for your own account")
+			fmt.Fprintln(os.Stderr, "Using InputPeerSelf for your own account")
 			return &tg.InputPeerSelf{}, nil
 		}
 
@@ -234,9 +286,9 @@ func getInputPeerFromChatID(ctx context.Context, client *telegram.Client, chatID
 		// Ищем канал по ID
 		for _, chat := range chats {
 			if c, ok := chat.(*tg.Channel); ok {
-				fmt.Printf("Checking channel ID: %d\n", c.ID)
+				fmt.Fprintf(os.Stderr, "Checking channel ID: %d\n", c.ID)
 				if c.ID == rawID {
-					fmt.Printf("Found channel with ID %d, access hash: %d\n", c.ID, c.AccessHash)
+					fmt.Fprintf(os.Stderr, "Found channel with ID %d, access hash: %d\n", c.ID, c.AccessHash)
 					return &tg.InputPeerChannel{
 						ChannelID:  c.ID,
 						AccessHash: c.AccessHash,
@@ -248,9 +300,9 @@ func getInputPeerFromChatID(ctx context.Context, client *telegram.Client, chatID
 		// Это обычный групповой чат
 		for _, chat := range chats {
 			if c, ok := chat.(*tg.Chat); ok {
-				fmt.Printf("Checking chat ID: %d\n", c.ID)
+				fmt.Fprintf(os.Stderr, "Checking chat ID: %d\n", c.ID)
 				if c.ID == rawID {
-					fmt.Printf("Found chat with ID %d\n", c.ID)
+					fmt.Fprintf(os.Stderr, "Found chat with ID %d\n", c.ID)
 					return &tg.InputPeerChat{
 						ChatID: c.ID,
 					}, nil
@@ -260,17 +312,17 @@ func getInputPeerFromChatID(ctx context.Context, client *telegram.Client, chatID
 	}
 
 	// Если не нашли, выводим более подробную информацию для отладки
-	fmt.Println("Could not find peer with specified ID. Available chats:")
+	fmt.Fprintln(os.Stderr, "Could not find peer with specified ID. Available chats:")
 	for _, chat := range chats {
 		switch c := chat.(type) {
 		case *tg.Chat:
-			fmt.Printf("Chat: ID=%d, Title=%s\n", c.ID, c.Title)
+			fmt.Fprintf(os.Stderr, "Chat: ID=%d, Title=%s\n", c.ID, c.Title)
 		case *tg.Channel:
 			cType := "Channel"
 			if c.Megagroup {
 				cType = "Supergroup"
 			}
-			fmt.Printf("%s: ID=%d, Title=%s, Username=%s\n", cType, c.ID, c.Title, c.Username)
+			fmt.Fprintf(os.Stderr, "%s: ID=%d, Title=%s, Username=%s\n", cType, c.ID, c.Title, c.Username)
 		}
 	}
 
@@ -302,6 +354,27 @@ func extractMessages(historyClass tg.MessagesMessagesClass, chatID int64) (*Mess
 	}
 
 	// Создаем карты для быстрого доступа к пользователям и чатам по ID
+	userMap, chatMap := entityMaps(users, chats)
+
+	// Создаем результат
+	result := &MessagesResponse{
+		Messages: make([]MessageInfo, 0, len(messages)),
+		ChatID:   chatID,
+	}
+
+	// Обрабатываем каждое сообщение
+	for _, msgClass := range messages {
+		if msgInfo, ok := extractMessage(msgClass, userMap, chatMap); ok {
+			result.Messages = append(result.Messages, msgInfo)
+		}
+	}
+
+	result.Count = len(result.Messages)
+	return result, nil
+}
+
+// entityMaps строит карты пользователей и чатов ответа по их ID
+func entityMaps(users []tg.UserClass, chats []tg.ChatClass) (map[int64]tg.UserClass, map[int64]tg.ChatClass) {
 	userMap := make(map[int64]tg.UserClass)
 	chatMap := make(map[int64]tg.ChatClass)
 
@@ -321,236 +394,151 @@ func extractMessages(historyClass tg.MessagesMessagesClass, chatID int64) (*Mess
 			chatMap[chat.GetID()] = chat
 		}
 	}
+	return userMap, chatMap
+}
 
-	// Создаем результат
-	result := &MessagesResponse{
-		Messages: make([]MessageInfo, 0, len(messages)),
-		ChatID:   chatID,
-	}
-
-	// Обрабатываем каждое сообщение
-	for _, msgClass := range messages {
-		// Преобразуем к сообщению
-		msg, ok := msgClass.(*tg.Message)
-		if !ok {
-			// Пропускаем служебные сообщения и другие типы
-			continue
-		}
-
-		// Базовая информация о сообщении
+// extractMessage преобразует сообщение в MessageInfo; пустые сообщения пропускаются
+func extractMessage(msgClass tg.MessageClass, userMap map[int64]tg.UserClass, chatMap map[int64]tg.ChatClass) (MessageInfo, bool) {
+	// Служебные сообщения (вступления, смена названия, закрепления и т.п.)
+	if service, ok := msgClass.(*tg.MessageService); ok {
 		msgInfo := MessageInfo{
-			ID:          msg.ID,
-			Date:        msg.Date,
-			Text:        msg.Message,
-			Type:        "message",
-			IsOutgoing:  msg.Out,
-			IsMentioned: msg.Mentioned,
+			ID:          service.ID,
+			ChatID:      peerToChatID(service.PeerID),
+			Date:        service.Date,
+			Type:        "service",
+			IsOutgoing:  service.Out,
+			IsMentioned: service.Mentioned,
+			Sender:      lookupSender(service, userMap, chatMap),
+			Action:      extractServiceAction(service),
+		}
+		if header, ok := service.ReplyTo.(*tg.MessageReplyHeader); ok {
+			msgInfo.TopicID = replyHeaderTopic(header)
 		}
+		return msgInfo, true
+	}
 
-		// Информация об отправителе
-		fromID, senderType := extractSenderInfo(msg)
-		if fromID != 0 {
-			// Ищем отправителя в зависимости от типа
-			if senderType == "user" && userMap[fromID] != nil {
-				user := userMap[fromID].(*tg.User)
-				msgInfo.Sender = &MessageSender{
-					ID:        user.GetID(),
-					Type:      "user",
-					Username:  user.Username,
-					FirstName: user.FirstName,
-					LastName:  user.LastName,
-					IsBot:     user.Bot,
-				}
-			} else if (senderType == "chat" || senderType == "channel") && chatMap[fromID] != nil {
-				var chatTitle, chatUsername string
-
-				// Определяем тип чата
-				if chat, ok := chatMap[fromID].(*tg.Chat); ok {
-					chatTitle = chat.Title
-				} else if channel, ok := chatMap[fromID].(*tg.Channel); ok {
-					chatTitle = channel.Title
-					chatUsername = channel.Username
-				}
+	// Преобразуем к сообщению
+	msg, ok := msgClass.(*tg.Message)
+	if !ok {
+		// Пропускаем пустые сообщения
+		return MessageInfo{}, false
+	}
 
-				msgInfo.Sender = &MessageSender{
-					ID:       fromID,
-					Type:     senderType,
-					Username: chatUsername,
-					// Для чатов используем title как FirstName
-					FirstName: chatTitle,
-				}
-			}
-		}
+	// Базовая информация о сообщении
+	msgInfo := MessageInfo{
+		ID:          msg.ID,
+		ChatID:      peerToChatID(msg.PeerID),
+		Date:        msg.Date,
+		Text:        msg.Message,
+		Type:        "message",
+		IsOutgoing:  msg.Out,
+		IsMentioned: msg.Mentioned,
+	}
 
-		// Если есть информация о форвардинге
-		fwdFrom, ok := msg.GetFwdFrom()
-		if ok {
-			msgInfo.Type = "forwarded_message"
-			// Информация о первоначальном отправителе
-			if fwdFrom.FromID != nil {
-				switch fromID := fwdFrom.FromID.(type) {
-				case *tg.PeerUser:
-					if user, ok := userMap[fromID.UserID]; ok {
-						if u, ok := user.(*tg.User); ok {
-							msgInfo.ForwardFrom = &MessageSender{
-								ID:        u.GetID(),
-								Type:      "user",
-								Username:  u.Username,
-								FirstName: u.FirstName,
-								LastName:  u.LastName,
-								IsBot:     u.Bot,
-							}
-						}
-					}
-				case *tg.PeerChannel:
-					if channel, ok := chatMap[fromID.ChannelID]; ok {
-						if c, ok := channel.(*tg.Channel); ok {
-							channelType := "channel"
-							if c.Megagroup {
-								channelType = "supergroup"
-							}
-							msgInfo.ForwardFrom = &MessageSender{
-								ID:        c.GetID(),
-								Type:      channelType,
-								Username:  c.Username,
-								FirstName: c.Title,
-							}
-						}
-					}
-				}
+	// Информация об отправителе; без FromID отправитель — сам чат:
+	// канал для постов или собеседник для входящих личных сообщений
+	msgInfo.Sender = lookupSender(msg, userMap, chatMap)
+	if msgInfo.Sender == nil {
+		switch msg.PeerID.(type) {
+		case *tg.PeerChannel:
+			msgInfo.Sender = peerSender(msg.PeerID, userMap, chatMap)
+		case *tg.PeerUser:
+			if !msg.Out {
+				msgInfo.Sender = peerSender(msg.PeerID, userMap, chatMap)
 			}
 		}
+	}
 
-		// Информация о replied сообщении
-		replyTo, ok := msg.GetReplyTo()
-		if ok {
-			if replyHeader, ok := replyTo.(*tg.MessageReplyHeader); ok {
-				msgInfo.ReplyToMsgID = replyHeader.ReplyToMsgID
-			}
-		}
+	// Сообщения от имени канала или анонимного администратора
+	msgInfo.SenderChat = senderChat(msg, chatMap)
 
-		// Информация о форматировании текста
-		entities, ok := msg.GetEntities()
-		if ok && len(entities) > 0 {
-			msgInfo.Entities = make([]MessageEntity, 0, len(entities))
-			for _, entity := range entities {
-				switch e := entity.(type) {
-				case *tg.MessageEntityBold:
-					msgInfo.Entities = append(msgInfo.Entities, MessageEntity{
-						Type:   "bold",
-						Offset: e.Offset,
-						Length: e.Length,
-					})
-				case *tg.MessageEntityItalic:
-					msgInfo.Entities = append(msgInfo.Entities, MessageEntity{
-						Type:   "italic",
-						Offset: e.Offset,
-						Length: e.Length,
-					})
-				case *tg.MessageEntityCode:
-					msgInfo.Entities = append(msgInfo.Entities, MessageEntity{
-						Type:   "code",
-						Offset: e.Offset,
-						Length: e.Length,
-					})
-				case *tg.MessageEntityPre:
-					msgInfo.Entities = append(msgInfo.Entities, MessageEntity{
-						Type:     "pre",
-						Offset:   e.Offset,
-						Length:   e.Length,
-						Language: e.Language,
-					})
-				case *tg.MessageEntityURL:
-					msgInfo.Entities = append(msgInfo.Entities, MessageEntity{
-						Type:   "url",
-						Offset: e.Offset,
-						Length: e.Length,
-					})
-				case *tg.MessageEntityTextURL:
-					msgInfo.Entities = append(msgInfo.Entities, MessageEntity{
-						Type:   "text_url",
-						Offset: e.Offset,
-						Length: e.Length,
-						URL:    e.URL,
-					})
-				case *tg.MessageEntityMention:
-					msgInfo.Entities = append(msgInfo.Entities, MessageEntity{
-						Type:   "mention",
-						Offset: e.Offset,
-						Length: e.Length,
-					})
-				case *tg.MessageEntityMentionName:
-					msgInfo.Entities = append(msgInfo.Entities, MessageEntity{
-						Type:   "mention_name",
-						Offset: e.Offset,
-						Length: e.Length,
-						UserID: e.UserID,
-					})
-				}
-			}
+	// Если есть информация о форвардинге
+	fwdFrom, ok := msg.GetFwdFrom()
+	if ok {
+		msgInfo.Type = "forwarded_message"
+		msgInfo.Forward = extractForward(fwdFrom, userMap, chatMap)
+		// Информация о первоначальном отправителе
+		msgInfo.ForwardFrom = msgInfo.Forward.From
+	}
+
+	// Информация о replied сообщении
+	replyTo, ok := msg.GetReplyTo()
+	if ok {
+		if replyHeader, ok := replyTo.(*tg.MessageReplyHeader); ok {
+			msgInfo.ReplyToMsgID = replyHeader.ReplyToMsgID
+			msgInfo.ReplyToTopID = replyHeader.ReplyToTopID
+			msgInfo.TopicID = replyHeaderTopic(replyHeader)
 		}
+	}
 
-		// Информация о медиа
-		media, ok := msg.GetMedia()
-		if ok {
-			msgInfo.Type = "media_message"
-			switch media := media.(type) {
-			case *tg.MessageMediaPhoto:
-				msgInfo.MediaType = "photo"
-			case *tg.MessageMediaDocument:
-				if doc, ok := media.Document.(*tg.Document); ok {
-					// Определяем тип документа по MIME-типу
-					mimeType := doc.MimeType
-					switch {
-					case mimeType == "video/mp4":
-						msgInfo.MediaType = "video"
-					case mimeType == "audio/mpeg" || mimeType == "audio/mp3":
-						msgInfo.MediaType = "audio"
-					case mimeType == "image/gif":
-						msgInfo.MediaType = "gif"
-					case mimeType == "application/vnd.ms-excel" || mimeType == "application/msword" ||
-						mimeType == "application/pdf" || mimeType == "application/zip":
-						msgInfo.MediaType = "document"
-					default:
-						msgInfo.MediaType = "file"
-					}
-				}
+	// Информация о форматировании текста
+	entities, ok := msg.GetEntities()
+	if ok && len(entities) > 0 {
+		msgInfo.Entities = extractEntities(entities)
+	}
+
+	// Информация о медиа
+	media, ok := msg.GetMedia()
+	if ok {
+		if info := extractMedia(media); info != nil {
+			// Превью ссылки не делает сообщение медиа-сообщением
+			if info.Type != "webpage" {
+				msgInfo.Type = "media_message"
 			}
+			msgInfo.MediaType = info.Type
+			msgInfo.Media = info
 		}
+	}
 
-		// Количество просмотров для сообщений в каналах
-		views, ok := msg.GetViews()
-		if ok {
-			msgInfo.Views = int(views)
-		}
+	// Количество просмотров для сообщений в каналах
+	views, ok := msg.GetViews()
+	if ok {
+		msgInfo.Views = int(views)
+	}
 
-		// Дата редактирования
-		editDate, ok := msg.GetEditDate()
-		if ok {
-			msgInfo.EditDate = editDate
-		}
+	// Дата редактирования
+	editDate, ok := msg.GetEditDate()
+	if ok {
+		msgInfo.EditDate = editDate
+	}
 
-		// Добавляем информацию в результат
-		result.Messages = append(result.Messages, msgInfo)
+	// Статистика поста: пересылки, ответы и реакции
+	if forwards, ok := msg.GetForwards(); ok {
+		msgInfo.Forwards = forwards
+	}
+	if replies, ok := msg.GetReplies(); ok {
+		msgInfo.Replies = replies.Replies
+	}
+	if reactions, ok := msg.GetReactions(); ok {
+		msgInfo.Reactions = extractReactions(reactions)
 	}
 
-	result.Count = len(result.Messages)
-	return result, nil
+	// Клавиатура с кнопками
+	if markup, ok := msg.GetReplyMarkup(); ok {
+		msgInfo.ReplyMarkup = extractReplyMarkup(markup)
+	}
+
+	// Прочие атрибуты сообщения
+	msgInfo.PostAuthor = msg.PostAuthor
+	msgInfo.ViaBotID = msg.ViaBotID
+	msgInfo.GroupedID = msg.GroupedID
+	msgInfo.TTLPeriod = msg.TTLPeriod
+	msgInfo.Pinned = msg.Pinned
+	msgInfo.NoForwards = msg.Noforwards
+
+	return msgInfo, true
 }
 
-// extractSenderInfo извлекает информацию об отправителе сообщения
-func extractSenderInfo(msg *tg.Message) (int64, string) {
-	// Проверяем различные поля, где может содержаться отправитель
+// lookupSender описывает отправителя из FromID; если его нет в ответе, заполняется только ID
+func lookupSender(msg senderMessage, userMap map[int64]tg.UserClass, chatMap map[int64]tg.ChatClass) *MessageSender {
 	fromID, ok := msg.GetFromID()
-	if ok {
-		switch peer := fromID.(type) {
-		case *tg.PeerUser:
-			return peer.UserID, "user"
-		case *tg.PeerChat:
-			return peer.ChatID, "chat"
-		case *tg.PeerChannel:
-			return peer.ChannelID, "channel"
-		}
+	if !ok {
+		return nil
 	}
-	return 0, ""
+	return peerSender(fromID, userMap, chatMap)
+}
+
+// senderMessage общий интерфейс обычных и служебных сообщений для определения отправителя
+type senderMessage interface {
+	GetFromID() (tg.PeerClass, bool)
 }
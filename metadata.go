@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/base64"
+	"unicode/utf8"
+
+	"github.com/gotd/td/tg"
+)
+
+// ReactionInfo содержит количество одной реакции на сообщение
+type ReactionInfo struct {
+	Type          string `json:"type"`
+	Emoji         string `json:"emoji,omitempty"`
+	CustomEmojiID int64  `json:"custom_emoji_id,omitempty"`
+	Count         int    `json:"count"`
+	Chosen        bool   `json:"chosen,omitempty"`
+}
+
+// ReplyMarkupInfo описывает клавиатуру, прикрепленную к сообщению
+type ReplyMarkupInfo struct {
+	Type        string         `json:"type"`
+	Rows        [][]ButtonInfo `json:"rows,omitempty"`
+	Resize      bool           `json:"resize,omitempty"`
+	SingleUse   bool           `json:"single_use,omitempty"`
+	Selective   bool           `json:"selective,omitempty"`
+	Persistent  bool           `json:"persistent,omitempty"`
+	Placeholder string         `json:"placeholder,omitempty"`
+}
+
+// ButtonInfo описывает одну кнопку клавиатуры
+type ButtonInfo struct {
+	Type       string `json:"type"`
+	Text       string `json:"text"`
+	URL        string `json:"url,omitempty"`
+	Data       string `json:"data,omitempty"`
+	DataBase64 string `json:"data_base64,omitempty"`
+	Query      string `json:"query,omitempty"`
+	UserID     int64  `json:"user_id,omitempty"`
+}
+
+// extractReactions преобразует реакции сообщения в список ReactionInfo
+func extractReactions(reactions tg.MessageReactions) []ReactionInfo {
+	result := make([]ReactionInfo, 0, len(reactions.Results))
+	for _, count := range reactions.Results {
+		info := ReactionInfo{Count: count.Count}
+		// Порядок выбора задан только для реакций, поставленных нами
+		_, info.Chosen = count.GetChosenOrder()
+
+		switch r := count.Reaction.(type) {
+		case *tg.ReactionEmoji:
+			info.Type = "emoji"
+			info.Emoji = r.Emoticon
+		case *tg.ReactionCustomEmoji:
+			info.Type = "custom_emoji"
+			info.CustomEmojiID = r.DocumentID
+		default:
+			info.Type = "unknown"
+		}
+		result = append(result, info)
+	}
+	return result
+}
+
+// extractReplyMarkup преобразует клавиатуру сообщения в ReplyMarkupInfo
+func extractReplyMarkup(markup tg.ReplyMarkupClass) *ReplyMarkupInfo {
+	switch m := markup.(type) {
+	case *tg.ReplyInlineMarkup:
+		return &ReplyMarkupInfo{Type: "inline_keyboard", Rows: extractButtonRows(m.Rows)}
+	case *tg.ReplyKeyboardMarkup:
+		return &ReplyMarkupInfo{
+			Type:        "reply_keyboard",
+			Rows:        extractButtonRows(m.Rows),
+			Resize:      m.Resize,
+			SingleUse:   m.SingleUse,
+			Selective:   m.Selective,
+			Persistent:  m.Persistent,
+			Placeholder: m.Placeholder,
+		}
+	case *tg.ReplyKeyboardHide:
+		return &ReplyMarkupInfo{Type: "hide_keyboard", Selective: m.Selective}
+	case *tg.ReplyKeyboardForceReply:
+		return &ReplyMarkupInfo{
+			Type:        "force_reply",
+			SingleUse:   m.SingleUse,
+			Selective:   m.Selective,
+			Placeholder: m.Placeholder,
+		}
+	}
+	return nil
+}
+
+// extractButtonRows преобразует строки кнопок клавиатуры
+func extractButtonRows(rows []tg.KeyboardButtonRow) [][]ButtonInfo {
+	result := make([][]ButtonInfo, 0, len(rows))
+	for _, row := range rows {
+		buttons := make([]ButtonInfo, 0, len(row.Buttons))
+		for _, button := range row.Buttons {
+			buttons = append(buttons, extractButton(button))
+		}
+		result = append(result, buttons)
+	}
+	return result
+}
+
+// extractButton преобразует одну кнопку клавиатуры
+func extractButton(button tg.KeyboardButtonClass) ButtonInfo {
+	info := ButtonInfo{Text: button.GetText()}
+	switch b := button.(type) {
+	case *tg.KeyboardButton:
+		info.Type = "text"
+	case *tg.KeyboardButtonURL:
+		info.Type = "url"
+		info.URL = b.URL
+	case *tg.KeyboardButtonCallback:
+		info.Type = "callback"
+		// Данные кнопки произвольные байты; текстовые выводим как есть
+		if utf8.Valid(b.Data) {
+			info.Data = string(b.Data)
+		} else {
+			info.DataBase64 = base64.StdEncoding.EncodeToString(b.Data)
+		}
+	case *tg.KeyboardButtonSwitchInline:
+		info.Type = "switch_inline"
+		info.Query = b.Query
+	case *tg.KeyboardButtonURLAuth:
+		info.Type = "url_auth"
+		info.URL = b.URL
+	case *tg.KeyboardButtonWebView:
+		info.Type = "web_view"
+		info.URL = b.URL
+	case *tg.KeyboardButtonSimpleWebView:
+		info.Type = "simple_web_view"
+		info.URL = b.URL
+	case *tg.KeyboardButtonUserProfile:
+		info.Type = "user_profile"
+		info.UserID = b.UserID
+	case *tg.KeyboardButtonRequestPhone:
+		info.Type = "request_phone"
+	case *tg.KeyboardButtonRequestGeoLocation:
+		info.Type = "request_location"
+	case *tg.KeyboardButtonRequestPoll:
+		info.Type = "request_poll"
+	case *tg.KeyboardButtonRequestPeer:
+		info.Type = "request_peer"
+	case *tg.KeyboardButtonGame:
+		info.Type = "game"
+	case *tg.KeyboardButtonBuy:
+		info.Type = "buy"
+	default:
+		info.Type = "unknown"
+	}
+	return info
+}
+
+// replyHeaderTopic возвращает ID темы форума, в которой находится сообщение
+func replyHeaderTopic(header *tg.MessageReplyHeader) int {
+	if !header.ForumTopic {
+		return 0
+	}
+	// Сообщение без ответа внутри темы ссылается на ее первое сообщение, ID которого и есть ID темы
+	if header.ReplyToTopID != 0 {
+		return header.ReplyToTopID
+	}
+	return header.ReplyToMsgID
+}
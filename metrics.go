@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Метрики отслеживания событий; без --metrics-addr они собираются, но никуда не отдаются
+var (
+	metricEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tg_events_received_total",
+		Help: "Events received from Telegram before filtering, by event type and chat type.",
+	}, []string{"type", "chat_type"})
+	metricLastEvent = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "tg_last_event_timestamp_seconds",
+		Help: "Unix time of the last received event.",
+	})
+	metricSinkLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tg_sink_delivery_duration_seconds",
+		Help:    "Time to deliver an event or a batch to the sink, including retries.",
+		Buckets: []float64{.001, .005, .01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"sink"})
+	metricSinkFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tg_sink_delivery_failures_total",
+		Help: "Sink deliveries that failed after all retries.",
+	}, []string{"sink"})
+	metricRPCCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tg_rpc_calls_total",
+		Help: "Telegram API calls by method and result: OK or the RPC error type.",
+	}, []string{"method", "code"})
+	metricFloodWait = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tg_flood_wait_seconds_total",
+		Help: "Total FLOOD_WAIT delay requested by Telegram.",
+	})
+	metricReconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tg_reconnects_total",
+		Help: "Restarts of the Telegram client by the daemon after an error.",
+	})
+	metricDifferenceRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tg_update_difference_requests_total",
+		Help: "getDifference (common) and getChannelDifference (channel) requests, for gaps as well as startup catch-up and polling.",
+	}, []string{"kind"})
+)
+
+// startMetricsServer отдает метрики по http://addr/metrics; возвращенная функция останавливает сервер
+func startMetricsServer(addr string) (func(), error) {
+	if addr == "" {
+		return func() {}, nil
+	}
+
+	// Слушаем сразу, чтобы занятый порт был ошибкой запуска, а не предупреждением в фоне
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on metrics address: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintf(os.Stderr, "Warning: metrics server stopped: %v\n", err)
+		}
+	}()
+	fmt.Fprintf(os.Stderr, "Serving metrics on %s/metrics\n", listener.Addr())
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}, nil
+}
+
+// metricsMiddleware считает вызовы API, FLOOD_WAIT и запросы пропущенных обновлений.
+// getDifference вызывается не только при пропусках, но и при запуске и опросе каналов,
+// поэтому метрика считает все такие запросы
+func metricsMiddleware() telegram.Middleware {
+	return telegram.MiddlewareFunc(func(next tg.Invoker) telegram.InvokeFunc {
+		return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+			method := "unknown"
+			if t, ok := input.(interface{ TypeName() string }); ok {
+				method = t.TypeName()
+			}
+			switch method {
+			case "updates.getDifference":
+				metricDifferenceRequests.WithLabelValues("common").Inc()
+			case "updates.getChannelDifference":
+				metricDifferenceRequests.WithLabelValues("channel").Inc()
+			}
+
+			err := next.Invoke(ctx, input, output)
+			metricRPCCalls.WithLabelValues(method, rpcResultCode(err)).Inc()
+			if d, ok := tgerr.AsFloodWait(err); ok {
+				metricFloodWait.Add(d.Seconds())
+			}
+			return err
+		}
+	})
+}
+
+// rpcResultCode возвращает OK, тип ошибки RPC (FLOOD_WAIT, AUTH_KEY_UNREGISTERED...) или общий признак сбоя
+func rpcResultCode(err error) string {
+	if err == nil {
+		return "OK"
+	}
+	if rpcErr, ok := tgerr.As(err); ok {
+		return rpcErr.Type
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return "CANCELED"
+	}
+	return "NETWORK_ERROR"
+}
+
+// observeEvent учитывает полученное событие
+func observeEvent(event *EventInfo) {
+	chatType := event.ChatType
+	if chatType == "" {
+		chatType = "none"
+	}
+	metricEvents.WithLabelValues(string(event.Type), chatType).Inc()
+	metricLastEvent.SetToCurrentTime()
+}
+
+// observeSinkDelivery учитывает длительность и результат доставки в приемник
+func observeSinkDelivery(sink string, start time.Time, err error) {
+	metricSinkLatency.WithLabelValues(sink).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metricSinkFailures.WithLabelValues(sink).Inc()
+	}
+}
+
+// instrumentedSink измеряет доставку для синхронных приемников. Асинхронные
+// (webhook, брокеры) учитывают доставку сами, там, где она действительно происходит
+type instrumentedSink struct {
+	name string
+	EventSink
+}
+
+func (s instrumentedSink) Send(ctx context.Context, event EventInfo) error {
+	start := time.Now()
+	err := s.EventSink.Send(ctx, event)
+	observeSinkDelivery(s.name, start, err)
+	return err
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gotd/td/tg"
+)
+
+// peerCache накапливает пользователей и чаты из обновлений: короткие обновления
+// приходят без сущностей, и имена берутся из ранее увиденных
+type peerCache struct {
+	mux   sync.Mutex
+	users map[int64]tg.UserClass
+	chats map[int64]tg.ChatClass
+}
+
+// newPeerCache создает пустой кэш
+func newPeerCache() *peerCache {
+	return &peerCache{
+		users: map[int64]tg.UserClass{},
+		chats: map[int64]tg.ChatClass{},
+	}
+}
+
+// lookup добавляет сущности обновления в кэш и вызывает fn с картами пользователей и чатов.
+// Карты действительны только внутри fn: обработчики обновлений каналов работают параллельно
+func (c *peerCache) lookup(entities tg.Entities, fn func(userMap map[int64]tg.UserClass, chatMap map[int64]tg.ChatClass)) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	for id, user := range entities.Users {
+		// Неполные (min) данные не должны затирать уже известные полные
+		if known, ok := c.users[id].(*tg.User); ok && user.Min && !known.Min {
+			continue
+		}
+		c.users[id] = user
+	}
+	for id, chat := range entities.Chats {
+		c.chats[id] = chat
+	}
+	for id, channel := range entities.Channels {
+		if known, ok := c.chats[id].(*tg.Channel); ok && channel.Min && !known.Min {
+			continue
+		}
+		c.chats[id] = channel
+	}
+
+	fn(c.users, c.chats)
+}
+
+// peerTitle возвращает название чата или имя собеседника для Peer
+func peerTitle(peer tg.PeerClass, userMap map[int64]tg.UserClass, chatMap map[int64]tg.ChatClass) string {
+	switch p := peer.(type) {
+	case *tg.PeerUser:
+		if user, ok := userMap[p.UserID].(*tg.User); ok {
+			return strings.TrimSpace(fmt.Sprintf("%s %s", user.FirstName, user.LastName))
+		}
+	case *tg.PeerChat:
+		if chat, ok := chatMap[p.ChatID].(*tg.Chat); ok {
+			return chat.Title
+		}
+	case *tg.PeerChannel:
+		if channel, ok := chatMap[p.ChannelID].(*tg.Channel); ok {
+			return channel.Title
+		}
+	}
+	return ""
+}
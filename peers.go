@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+)
+
+// channelIDOffset смещение, с которым ID каналов и супергрупп выводятся в формате -100XXXXXXXXXX
+const channelIDOffset = 1000000000000
+
+// peerToChatID преобразует Peer в ID чата в формате Bot API
+func peerToChatID(peer tg.PeerClass) int64 {
+	switch p := peer.(type) {
+	case *tg.PeerUser:
+		return p.UserID
+	case *tg.PeerChat:
+		return -p.ChatID
+	case *tg.PeerChannel:
+		return -channelIDOffset - p.ChannelID
+	}
+	return 0
+}
+
+// resolvePeer находит InputPeer по ID чата, @username или "me"
+func resolvePeer(ctx context.Context, client *telegram.Client, value string) (tg.InputPeerClass, int64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, 0, fmt.Errorf("empty peer")
+	}
+
+	// Собственный аккаунт
+	if value == "me" || value == "self" {
+		self, err := client.Self(ctx)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to get self: %w", err)
+		}
+		return &tg.InputPeerSelf{}, self.ID, nil
+	}
+
+	// Числовой ID ищем среди диалогов
+	if chatID, err := strconv.ParseInt(value, 10, 64); err == nil {
+		peer, err := getInputPeerFromChatID(ctx, client, chatID)
+		if err != nil {
+			return nil, 0, err
+		}
+		return peer, chatID, nil
+	}
+
+	// Иначе считаем значение именем пользователя или ссылкой t.me
+	username := strings.TrimPrefix(value, "@")
+	username = strings.TrimPrefix(username, "https://t.me/")
+	resolved, err := client.API().ContactsResolveUsername(ctx, username)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to resolve username %q: %w", username, err)
+	}
+
+	peer, ok := inputPeerFromEntities(resolved.Peer, resolved.Users, resolved.Chats)
+	if !ok {
+		return nil, 0, fmt.Errorf("username %q resolved to unknown peer", username)
+	}
+	return peer, peerToChatID(resolved.Peer), nil
+}
+
+// inputPeerFromEntities строит InputPeer из Peer, используя access hash из списков пользователей и чатов
+func inputPeerFromEntities(peer tg.PeerClass, users []tg.UserClass, chats []tg.ChatClass) (tg.InputPeerClass, bool) {
+	switch p := peer.(type) {
+	case *tg.PeerUser:
+		for _, u := range users {
+			if user, ok := u.(*tg.User); ok && user.ID == p.UserID {
+				return user.AsInputPeer(), true
+			}
+		}
+	case *tg.PeerChat:
+		return &tg.InputPeerChat{ChatID: p.ChatID}, true
+	case *tg.PeerChannel:
+		for _, c := range chats {
+			switch channel := c.(type) {
+			case *tg.Channel:
+				if channel.ID == p.ChannelID {
+					return channel.AsInputPeer(), true
+				}
+			case *tg.ChannelForbidden:
+				if channel.ID == p.ChannelID {
+					return &tg.InputPeerChannel{ChannelID: channel.ID, AccessHash: channel.AccessHash}, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// chatIDToPeer преобразует ID чата в формате Bot API обратно в Peer
+func chatIDToPeer(chatID int64) tg.PeerClass {
+	switch {
+	case chatID <= -channelIDOffset:
+		return &tg.PeerChannel{ChannelID: -(chatID + channelIDOffset)}
+	case chatID < 0:
+		return &tg.PeerChat{ChatID: -chatID}
+	default:
+		return &tg.PeerUser{UserID: chatID}
+	}
+}
+
+// inputChannelFromPeer возвращает InputChannel, если InputPeer указывает на канал или супергруппу
+func inputChannelFromPeer(peer tg.InputPeerClass) (*tg.InputChannel, bool) {
+	if p, ok := peer.(*tg.InputPeerChannel); ok {
+		return &tg.InputChannel{ChannelID: p.ChannelID, AccessHash: p.AccessHash}, true
+	}
+	return nil, false
+}
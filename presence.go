@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+)
+
+// typingRefreshInterval период повторной отправки статуса набора; Telegram сбрасывает его примерно через 5 секунд
+const typingRefreshInterval = 4 * time.Second
+
+// ReadOptions задает параметры отметки сообщений прочитанными
+type ReadOptions struct {
+	Chat      string // Чат: ID или @username
+	MaxID     int    // Прочитать сообщения до этого ID включительно; 0 означает все
+	TopicID   int    // Тема форума, в которой читаются сообщения
+	Mentions  bool   // Также прочитать упоминания
+	Reactions bool   // Также прочитать реакции
+}
+
+// ReadResult содержит результат отметки сообщений прочитанными
+type ReadResult struct {
+	ChatID    int64 `json:"chat_id"`
+	MaxID     int   `json:"max_id,omitempty"`
+	TopicID   int   `json:"topic_id,omitempty"`
+	Mentions  bool  `json:"mentions,omitempty"`
+	Reactions bool  `json:"reactions,omitempty"`
+}
+
+// TypingOptions задает параметры статуса набора
+type TypingOptions struct {
+	Chat     string        // Чат: ID или @username
+	Action   string        // Действие: typing, upload_photo и т.д.
+	TopicID  int           // Тема форума
+	Duration time.Duration // Сколько поддерживать статус; 0 означает однократную отправку
+}
+
+// TypingResult содержит результат установки статуса набора
+type TypingResult struct {
+	ChatID   int64  `json:"chat_id"`
+	Action   string `json:"action"`
+	Duration int    `json:"duration,omitempty"`
+}
+
+// StatusResult содержит результат смены статуса присутствия
+type StatusResult struct {
+	Status string `json:"status"`
+}
+
+// Значения статуса присутствия
+const (
+	StatusOnline  = "online"
+	StatusOffline = "offline"
+)
+
+// typingActions сопоставляет значения --action действиям Telegram (названия как в Bot API)
+var typingActions = map[string]func() tg.SendMessageActionClass{
+	"typing":            func() tg.SendMessageActionClass { return &tg.SendMessageTypingAction{} },
+	"cancel":            func() tg.SendMessageActionClass { return &tg.SendMessageCancelAction{} },
+	"upload_photo":      func() tg.SendMessageActionClass { return &tg.SendMessageUploadPhotoAction{} },
+	"record_video":      func() tg.SendMessageActionClass { return &tg.SendMessageRecordVideoAction{} },
+	"upload_video":      func() tg.SendMessageActionClass { return &tg.SendMessageUploadVideoAction{} },
+	"record_voice":      func() tg.SendMessageActionClass { return &tg.SendMessageRecordAudioAction{} },
+	"upload_voice":      func() tg.SendMessageActionClass { return &tg.SendMessageUploadAudioAction{} },
+	"upload_document":   func() tg.SendMessageActionClass { return &tg.SendMessageUploadDocumentAction{} },
+	"choose_sticker":    func() tg.SendMessageActionClass { return &tg.SendMessageChooseStickerAction{} },
+	"find_location":     func() tg.SendMessageActionClass { return &tg.SendMessageGeoLocationAction{} },
+	"choose_contact":    func() tg.SendMessageActionClass { return &tg.SendMessageChooseContactAction{} },
+	"record_video_note": func() tg.SendMessageActionClass { return &tg.SendMessageRecordRoundAction{} },
+	"upload_video_note": func() tg.SendMessageActionClass { return &tg.SendMessageUploadRoundAction{} },
+}
+
+// typingAction возвращает действие Telegram по его имени
+func typingAction(name string) (tg.SendMessageActionClass, error) {
+	create, ok := typingActions[name]
+	if !ok {
+		names := make([]string, 0, len(typingActions))
+		for n := range typingActions {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown action %q: expected one of %s", name, strings.Join(names, ", "))
+	}
+	return create(), nil
+}
+
+// ReadHistory отмечает сообщения чата прочитанными и выводит результат в формате JSON
+func ReadHistory(ctx context.Context, config AuthConfig, opts ReadOptions) error {
+	return runAuthorized(ctx, config, func(ctx context.Context, client *telegram.Client) error {
+		api := client.API()
+
+		peer, chatID, err := resolvePeer(ctx, client, opts.Chat)
+		if err != nil {
+			return fmt.Errorf("failed to resolve chat: %w", err)
+		}
+
+		fmt.Fprintf(os.Stderr, "Marking messages in chat %d as read...\n", chatID)
+		switch channel, isChannel := inputChannelFromPeer(peer); {
+		case opts.TopicID != 0:
+			// Тема форума читается как ветка обсуждения; без max-id читаем до последнего сообщения
+			maxID := opts.MaxID
+			if maxID == 0 {
+				if maxID, err = lastTopicMessageID(ctx, api, peer, opts.TopicID); err != nil {
+					return err
+				}
+			}
+			_, err = withFloodWait(ctx, func() (bool, error) {
+				return api.MessagesReadDiscussion(ctx, &tg.MessagesReadDiscussionRequest{
+					Peer:      peer,
+					MsgID:     opts.TopicID,
+					ReadMaxID: maxID,
+				})
+			})
+		case isChannel:
+			_, err = withFloodWait(ctx, func() (bool, error) {
+				return api.ChannelsReadHistory(ctx, &tg.ChannelsReadHistoryRequest{Channel: channel, MaxID: opts.MaxID})
+			})
+		default:
+			_, err = withFloodWait(ctx, func() (*tg.MessagesAffectedMessages, error) {
+				return api.MessagesReadHistory(ctx, &tg.MessagesReadHistoryRequest{Peer: peer, MaxID: opts.MaxID})
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read history: %w", err)
+		}
+
+		// Упоминания и реакции читаются порциями, пока сервер возвращает ненулевое смещение
+		if opts.Mentions {
+			if err := readAffected(ctx, func() (*tg.MessagesAffectedHistory, error) {
+				return api.MessagesReadMentions(ctx, &tg.MessagesReadMentionsRequest{Peer: peer, TopMsgID: opts.TopicID})
+			}); err != nil {
+				return fmt.Errorf("failed to read mentions: %w", err)
+			}
+		}
+		if opts.Reactions {
+			if err := readAffected(ctx, func() (*tg.MessagesAffectedHistory, error) {
+				return api.MessagesReadReactions(ctx, &tg.MessagesReadReactionsRequest{Peer: peer, TopMsgID: opts.TopicID})
+			}); err != nil {
+				return fmt.Errorf("failed to read reactions: %w", err)
+			}
+		}
+
+		return printJSON(ReadResult{
+			ChatID:    chatID,
+			MaxID:     opts.MaxID,
+			TopicID:   opts.TopicID,
+			Mentions:  opts.Mentions,
+			Reactions: opts.Reactions,
+		})
+	})
+}
+
+// lastTopicMessageID возвращает ID последнего сообщения темы форума
+func lastTopicMessageID(ctx context.Context, api *tg.Client, peer tg.InputPeerClass, topicID int) (int, error) {
+	replies, err := withFloodWait(ctx, func() (tg.MessagesMessagesClass, error) {
+		return api.MessagesGetReplies(ctx, &tg.MessagesGetRepliesRequest{Peer: peer, MsgID: topicID, Limit: 1})
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last message of topic %d: %w", topicID, err)
+	}
+	raw, err := historyMessages(replies)
+	if err != nil {
+		return 0, err
+	}
+	if len(raw) == 0 {
+		return topicID, nil
+	}
+	id, _ := messageIDAndDate(raw[0])
+	return id, nil
+}
+
+// readAffected повторяет запрос, пока он затрагивает не всю историю сразу
+func readAffected(ctx context.Context, call func() (*tg.MessagesAffectedHistory, error)) error {
+	for {
+		affected, err := withFloodWait(ctx, call)
+		if err != nil {
+			return err
+		}
+		if affected.Offset == 0 {
+			return nil
+		}
+	}
+}
+
+// SetTyping показывает в чате статус набора или загрузки и выводит результат в формате JSON
+func SetTyping(ctx context.Context, config AuthConfig, opts TypingOptions) error {
+	action, err := typingAction(opts.Action)
+	if err != nil {
+		return err
+	}
+
+	return runAuthorized(ctx, config, func(ctx context.Context, client *telegram.Client) error {
+		peer, chatID, err := resolvePeer(ctx, client, opts.Chat)
+		if err != nil {
+			return fmt.Errorf("failed to resolve chat: %w", err)
+		}
+
+		setTyping := func() error {
+			_, err := withFloodWait(ctx, func() (bool, error) {
+				return client.API().MessagesSetTyping(ctx, &tg.MessagesSetTypingRequest{
+					Peer:     peer,
+					TopMsgID: opts.TopicID,
+					Action:   action,
+				})
+			})
+			if err != nil {
+				return fmt.Errorf("failed to set typing status: %w", err)
+			}
+			return nil
+		}
+
+		fmt.Fprintf(os.Stderr, "Setting %s status in chat %d...\n", opts.Action, chatID)
+		if err := setTyping(); err != nil {
+			return err
+		}
+
+		// Статус гаснет сам, поэтому для длительного показа повторяем его
+		if opts.Duration > 0 {
+			deadline := time.NewTimer(opts.Duration)
+			defer deadline.Stop()
+			ticker := time.NewTicker(typingRefreshInterval)
+			defer ticker.Stop()
+
+		refresh:
+			for {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-deadline.C:
+					break refresh
+				case <-ticker.C:
+					if err := setTyping(); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		return printJSON(TypingResult{
+			ChatID:   chatID,
+			Action:   opts.Action,
+			Duration: int(opts.Duration.Seconds()),
+		})
+	})
+}
+
+// UpdateStatus переводит аккаунт в онлайн или офлайн и выводит результат в формате JSON
+func UpdateStatus(ctx context.Context, config AuthConfig, status string) error {
+	return runAuthorized(ctx, config, func(ctx context.Context, client *telegram.Client) error {
+		fmt.Fprintf(os.Stderr, "Setting status to %s...\n", status)
+		_, err := withFloodWait(ctx, func() (bool, error) {
+			return client.API().AccountUpdateStatus(ctx, status == StatusOffline)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update status: %w", err)
+		}
+		return printJSON(StatusResult{Status: status})
+	})
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// diskQueue хранит недоставленные записи файлами в каталоге; порядок файлов совпадает с порядком добавления
+type diskQueue struct {
+	dir string
+	seq atomic.Uint64
+	mux sync.Mutex // Не дает двум обходам очереди отправить одну запись дважды
+}
+
+// errQueueRejected оборачивает ошибку записи, которую повторять бессмысленно
+type errQueueRejected struct {
+	err error
+}
+
+func (e errQueueRejected) Error() string { return e.err.Error() }
+
+// newDiskQueue создает каталог очереди при необходимости
+func newDiskQueue(dir string) (*diskQueue, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create queue directory: %w", err)
+	}
+	return &diskQueue{dir: dir}, nil
+}
+
+// Push атомарно сохраняет запись в конец очереди; после возврата запись переживет сбой процесса
+func (q *diskQueue) Push(data []byte) error {
+	name := fmt.Sprintf("%020d-%06d.json", time.Now().UnixNano(), q.seq.Add(1))
+	tmp := filepath.Join(q.dir, name+".tmp")
+	if err := writeFileSync(tmp, data, 0o600); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(q.dir, name))
+}
+
+// Len возвращает число записей в очереди
+func (q *diskQueue) Len() int {
+	files, _ := filepath.Glob(filepath.Join(q.dir, "*.json"))
+	return len(files)
+}
+
+// Drain передает записи в deliver по одной, см. DrainBatch
+func (q *diskQueue) Drain(deliver func(data []byte) error) error {
+	return q.DrainBatch(1, func(items [][]byte) error {
+		return deliver(items[0])
+	})
+}
+
+// DrainBatch передает записи в deliver по порядку пакетами до size штук и удаляет
+// доставленные. Обход останавливается на первой ошибке; пакеты, отвергнутые
+// окончательно (errQueueRejected), переименовываются в .rejected и пропускаются
+func (q *diskQueue) DrainBatch(size int, deliver func(items [][]byte) error) error {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(q.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for len(files) > 0 {
+		var batch []string
+		var items [][]byte
+		for len(files) > 0 && len(items) < size {
+			file := files[0]
+			files = files[1:]
+			data, err := os.ReadFile(file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to read queued entry %s: %v\n", file, err)
+				continue
+			}
+			batch = append(batch, file)
+			items = append(items, data)
+		}
+		if len(items) == 0 {
+			continue
+		}
+
+		if err := deliver(items); err != nil {
+			if rejected, ok := err.(errQueueRejected); ok {
+				// Оставляем записи для разбора, но больше не повторяем
+				fmt.Fprintf(os.Stderr, "Warning: %d queued entries rejected, first %s: %v\n", len(batch), batch[0], rejected.err)
+				for _, file := range batch {
+					os.Rename(file, file+".rejected")
+				}
+				continue
+			}
+			return err
+		}
+		for _, file := range batch {
+			os.Remove(file)
+		}
+	}
+	return nil
+}
+
+// writeFileSync записывает файл и сбрасывает его на диск
+func writeFileSync(path string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+)
+
+// RepliesOptions задает параметры выборки ответов в ветке обсуждения
+type RepliesOptions struct {
+	Chat    string         // Чат или канал с исходным сообщением: ID или @username
+	MsgID   int            // ID сообщения или поста, ответы на который нужны
+	History HistoryOptions // Параметры пагинации и границы по дате
+}
+
+// ThreadInfo содержит состояние ветки обсуждения из messages.getDiscussionMessage
+type ThreadInfo struct {
+	ChatID          int64 `json:"chat_id"`
+	MsgID           int   `json:"msg_id"`
+	Replies         int   `json:"replies"`
+	UnreadCount     int   `json:"unread_count"`
+	MaxID           int   `json:"max_id,omitempty"`
+	ReadInboxMaxID  int   `json:"read_inbox_max_id,omitempty"`
+	ReadOutboxMaxID int   `json:"read_outbox_max_id,omitempty"`
+}
+
+// RepliesResponse содержит ответы в ветке для вывода в JSON
+type RepliesResponse struct {
+	Messages []MessageInfo `json:"messages"`
+	Count    int           `json:"count"`
+	ChatID   int64         `json:"chat_id"`
+	MsgID    int           `json:"msg_id"`
+	Thread   *ThreadInfo   `json:"thread,omitempty"`
+}
+
+// GetReplies выводит ответы на сообщение или комментарии к посту канала
+func GetReplies(ctx context.Context, config AuthConfig, opts RepliesOptions) error {
+	return runAuthorized(ctx, config, func(ctx context.Context, client *telegram.Client) error {
+		api := client.API()
+
+		peer, chatID, err := resolvePeer(ctx, client, opts.Chat)
+		if err != nil {
+			return fmt.Errorf("failed to resolve chat: %w", err)
+		}
+
+		// Комментарии к посту канала хранятся в связанной группе обсуждения
+		thread, err := getThreadInfo(ctx, api, peer, opts.MsgID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to get discussion thread: %v\n", err)
+		}
+		threadChatID := chatID
+		if thread != nil {
+			threadChatID = thread.ChatID
+		}
+
+		fmt.Fprintf(os.Stderr, "Getting replies to message %d in chat %d...\n", opts.MsgID, chatID)
+		fetch := func(ctx context.Context, offsetID, offsetDate, limit int) (tg.MessagesMessagesClass, error) {
+			return api.MessagesGetReplies(ctx, &tg.MessagesGetRepliesRequest{
+				Peer:       peer,
+				MsgID:      opts.MsgID,
+				OffsetID:   offsetID,
+				OffsetDate: offsetDate,
+				Limit:      limit,
+				MinID:      opts.History.MinID,
+				MaxID:      opts.History.MaxID,
+			})
+		}
+
+		// При выгрузке всей ветки пишем сообщения потоком в NDJSON, а состояние ветки в stderr
+		if opts.History.All {
+			if thread != nil {
+				fmt.Fprintf(os.Stderr, "Thread %d in chat %d: %d replies, %d unread\n", thread.MsgID, thread.ChatID, thread.Replies, thread.UnreadCount)
+			}
+			encoder := json.NewEncoder(os.Stdout)
+			return walkHistory(ctx, fetch, opts.History, threadChatID, func(msg MessageInfo) error {
+				return encoder.Encode(msg)
+			})
+		}
+
+		result := &RepliesResponse{
+			Messages: make([]MessageInfo, 0, opts.History.Limit),
+			ChatID:   chatID,
+			MsgID:    opts.MsgID,
+			Thread:   thread,
+		}
+		if err := walkHistory(ctx, fetch, opts.History, threadChatID, func(msg MessageInfo) error {
+			result.Messages = append(result.Messages, msg)
+			return nil
+		}); err != nil {
+			return err
+		}
+		result.Count = len(result.Messages)
+
+		return printJSON(result)
+	})
+}
+
+// getThreadInfo запрашивает корневое сообщение ветки и ее счетчики прочтения
+func getThreadInfo(ctx context.Context, api *tg.Client, peer tg.InputPeerClass, msgID int) (*ThreadInfo, error) {
+	discussion, err := withFloodWait(ctx, func() (*tg.MessagesDiscussionMessage, error) {
+		return api.MessagesGetDiscussionMessage(ctx, &tg.MessagesGetDiscussionMessageRequest{
+			Peer:  peer,
+			MsgID: msgID,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ThreadInfo{
+		UnreadCount:     discussion.UnreadCount,
+		MaxID:           discussion.MaxID,
+		ReadInboxMaxID:  discussion.ReadInboxMaxID,
+		ReadOutboxMaxID: discussion.ReadOutboxMaxID,
+	}
+
+	// Для альбома корнем ветки считается первое сообщение с числом ответов
+	for _, m := range discussion.Messages {
+		msg, ok := m.(*tg.Message)
+		if !ok {
+			continue
+		}
+		if info.MsgID == 0 {
+			info.ChatID = peerToChatID(msg.PeerID)
+			info.MsgID = msg.ID
+		}
+		if replies, ok := msg.GetReplies(); ok {
+			info.ChatID = peerToChatID(msg.PeerID)
+			info.MsgID = msg.ID
+			info.Replies = replies.Replies
+			break
+		}
+	}
+	if info.MsgID == 0 {
+		return nil, fmt.Errorf("discussion message not found")
+	}
+	return info, nil
+}
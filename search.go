@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+)
+
+// SearchOptions задает параметры поиска сообщений
+type SearchOptions struct {
+	Query   string         // Поисковый запрос
+	Chat    string         // Чат для поиска; пустое значение означает глобальный поиск
+	From    string         // Отправитель сообщений (только для поиска в чате)
+	Filter  string         // Фильтр по типу сообщений
+	History HistoryOptions // Параметры пагинации и границы по дате
+}
+
+// SearchResponse содержит результаты поиска для вывода в JSON
+type SearchResponse struct {
+	Messages []MessageInfo `json:"messages"`
+	Count    int           `json:"count"`
+	Query    string        `json:"query"`
+	ChatID   int64         `json:"chat_id,omitempty"`
+}
+
+// searchFilters сопоставляет значения --filter фильтрам Telegram
+var searchFilters = map[string]tg.MessagesFilterClass{
+	"":         &tg.InputMessagesFilterEmpty{},
+	"photo":    &tg.InputMessagesFilterPhotos{},
+	"video":    &tg.InputMessagesFilterVideo{},
+	"document": &tg.InputMessagesFilterDocument{},
+	"url":      &tg.InputMessagesFilterURL{},
+	"voice":    &tg.InputMessagesFilterVoice{},
+	"pinned":   &tg.InputMessagesFilterPinned{},
+	"mentions": &tg.InputMessagesFilterMyMentions{},
+}
+
+// searchFilter возвращает фильтр Telegram по его имени
+func searchFilter(name string) (tg.MessagesFilterClass, error) {
+	filter, ok := searchFilters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown filter %q: expected photo, video, document, url, voice, pinned or mentions", name)
+	}
+	return filter, nil
+}
+
+// SearchMessages ищет сообщения в указанном чате или во всех чатах
+func SearchMessages(ctx context.Context, config AuthConfig, opts SearchOptions) error {
+	filter, err := searchFilter(opts.Filter)
+	if err != nil {
+		return err
+	}
+
+	return runAuthorized(ctx, config, func(ctx context.Context, client *telegram.Client) error {
+		api := client.API()
+
+		// Границы по дате Telegram фильтрует сам
+		var minDate, maxDate int
+		if !opts.History.Since.IsZero() {
+			minDate = int(opts.History.Since.Unix())
+		}
+		if !opts.History.Until.IsZero() {
+			maxDate = int(opts.History.Until.Unix())
+		}
+
+		var fetch historyPageFetcher
+		var chatID int64
+		if opts.Chat != "" {
+			// Поиск в одном чате через messages.search
+			peer, id, err := resolvePeer(ctx, client, opts.Chat)
+			if err != nil {
+				return fmt.Errorf("failed to resolve chat: %w", err)
+			}
+			chatID = id
+
+			var fromID tg.InputPeerClass
+			if opts.From != "" {
+				fromID, _, err = resolvePeer(ctx, client, opts.From)
+				if err != nil {
+					return fmt.Errorf("failed to resolve sender: %w", err)
+				}
+			}
+
+			fmt.Fprintf(os.Stderr, "Searching messages in chat %d...\n", chatID)
+			fetch = func(ctx context.Context, offsetID, _, limit int) (tg.MessagesMessagesClass, error) {
+				return api.MessagesSearch(ctx, &tg.MessagesSearchRequest{
+					Peer:     peer,
+					Q:        opts.Query,
+					FromID:   fromID,
+					Filter:   filter,
+					MinDate:  minDate,
+					MaxDate:  maxDate,
+					OffsetID: offsetID,
+					Limit:    limit,
+					MinID:    opts.History.MinID,
+					MaxID:    opts.History.MaxID,
+				})
+			}
+		} else {
+			// Глобальный поиск через messages.searchGlobal
+			if opts.From != "" {
+				return fmt.Errorf("--from requires --chat: global search cannot filter by sender")
+			}
+
+			// Следующая страница глобального поиска задается по последнему сообщению предыдущей
+			var prev tg.MessagesMessagesClass
+			fmt.Fprintln(os.Stderr, "Searching messages in all chats...")
+			fetch = func(ctx context.Context, offsetID, _, limit int) (tg.MessagesMessagesClass, error) {
+				req := &tg.MessagesSearchGlobalRequest{
+					Q:          opts.Query,
+					Filter:     filter,
+					MinDate:    minDate,
+					MaxDate:    maxDate,
+					OffsetPeer: &tg.InputPeerEmpty{},
+					OffsetID:   offsetID,
+					Limit:      limit,
+				}
+				if prev != nil {
+					req.OffsetRate, req.OffsetPeer = globalSearchOffset(prev)
+				}
+
+				result, err := api.MessagesSearchGlobal(ctx, req)
+				if err == nil {
+					prev = result
+				}
+				return result, err
+			}
+		}
+
+		// При выгрузке всех результатов пишем сообщения потоком в NDJSON
+		if opts.History.All {
+			encoder := json.NewEncoder(os.Stdout)
+			return walkHistory(ctx, fetch, opts.History, chatID, func(msg MessageInfo) error {
+				return encoder.Encode(msg)
+			})
+		}
+
+		result := &SearchResponse{
+			Messages: make([]MessageInfo, 0, opts.History.Limit),
+			Query:    opts.Query,
+			ChatID:   chatID,
+		}
+		if err := walkHistory(ctx, fetch, opts.History, chatID, func(msg MessageInfo) error {
+			result.Messages = append(result.Messages, msg)
+			return nil
+		}); err != nil {
+			return err
+		}
+		result.Count = len(result.Messages)
+
+		return printJSON(result)
+	})
+}
+
+// globalSearchOffset возвращает rate и peer для запроса следующей страницы глобального поиска
+func globalSearchOffset(prev tg.MessagesMessagesClass) (int, tg.InputPeerClass) {
+	slice, ok := prev.(*tg.MessagesMessagesSlice)
+	if !ok || len(slice.Messages) == 0 {
+		return 0, &tg.InputPeerEmpty{}
+	}
+
+	last, ok := slice.Messages[len(slice.Messages)-1].(interface{ GetPeerID() tg.PeerClass })
+	if !ok {
+		return slice.NextRate, &tg.InputPeerEmpty{}
+	}
+	peer, ok := inputPeerFromEntities(last.GetPeerID(), slice.Users, slice.Chats)
+	if !ok {
+		return slice.NextRate, &tg.InputPeerEmpty{}
+	}
+	return slice.NextRate, peer
+}
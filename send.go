@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+)
+
+// SendOptions задает параметры отправки сообщения
+type SendOptions struct {
+	Chat      string    // Чат назначения: ID или @username
+	Text      string    // Текст сообщения; "-" означает чтение из stdin, пустое значение — из перенаправленного stdin
+	ParseMode string    // Режим разметки: markdown или html
+	ReplyTo   int       // ID сообщения, на которое отвечаем
+	Silent    bool      // Отправить без звукового уведомления
+	NoWebpage bool      // Не показывать превью ссылок
+	Schedule  time.Time // Время отложенной отправки
+	TopicID   int       // ID темы форума
+	Files     []string  // Отправляемые файлы; "-" означает чтение из stdin
+	As        string    // Вид отправки файлов: photo, video, document, voice или audio
+	Caption   string    // Подпись к файлам
+	FileName  string    // Имя файла, читаемого из stdin
+}
+
+// SendMessage отправляет текстовое сообщение или файлы и выводит результат в формате JSON
+func SendMessage(ctx context.Context, config AuthConfig, opts SendOptions) error {
+	if len(opts.Files) > 0 {
+		return sendFiles(ctx, config, opts)
+	}
+
+	text, err := readMessageText(opts.Text)
+	if err != nil {
+		return err
+	}
+
+	// Преобразуем разметку в сущности Telegram
+	message, entities, err := parseFormattedText(text, opts.ParseMode)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(message) == "" {
+		return fmt.Errorf("message text is empty")
+	}
+
+	return runAuthorized(ctx, config, func(ctx context.Context, client *telegram.Client) error {
+		peer, chatID, err := resolvePeer(ctx, client, opts.Chat)
+		if err != nil {
+			return fmt.Errorf("failed to resolve chat: %w", err)
+		}
+		entities = resolveMentions(ctx, client, entities)
+
+		randomID, err := client.RandInt64()
+		if err != nil {
+			return fmt.Errorf("failed to generate random ID: %w", err)
+		}
+
+		req := &tg.MessagesSendMessageRequest{
+			Peer:      peer,
+			Message:   message,
+			Entities:  entities,
+			RandomID:  randomID,
+			Silent:    opts.Silent,
+			NoWebpage: opts.NoWebpage,
+			ReplyTo:   inputReplyTo(opts.ReplyTo, opts.TopicID),
+		}
+		if !opts.Schedule.IsZero() {
+			req.ScheduleDate = int(opts.Schedule.Unix())
+		}
+
+		fmt.Fprintf(os.Stderr, "Sending message to chat %d...\n", chatID)
+		updates, err := withFloodWait(ctx, func() (tg.UpdatesClass, error) {
+			return client.API().MessagesSendMessage(ctx, req)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send message: %w", err)
+		}
+
+		// Короткий ответ не содержит сообщения целиком, собираем его сами
+		if short, ok := updates.(*tg.UpdateShortSentMessage); ok {
+			updates = shortSentToUpdates(short, chatID, message, entities)
+		}
+
+		sent, err := firstMessageFromUpdates(updates, chatID)
+		if err != nil {
+			return err
+		}
+		return printJSON(sent)
+	})
+}
+
+// sendFiles отправляет один файл или альбом до 10 файлов с подписью
+func sendFiles(ctx context.Context, config AuthConfig, opts SendOptions) error {
+	// Подпись берется из --caption, а при его отсутствии из --text
+	caption := opts.Caption
+	if caption == "" && opts.Text != "" {
+		caption = opts.Text
+		if caption == "-" {
+			text, err := readMessageText(caption)
+			if err != nil {
+				return err
+			}
+			caption = text
+		}
+	}
+	message, entities, err := parseFormattedText(caption, opts.ParseMode)
+	if err != nil {
+		return err
+	}
+
+	// Готовим файлы заранее, чтобы ошибки обнаружились до подключения
+	files := make([]*uploadFile, 0, len(opts.Files))
+	defer func() {
+		for _, f := range files {
+			f.cleanup()
+		}
+	}()
+	for _, path := range opts.Files {
+		file, err := prepareUpload(path, opts.As, opts.FileName)
+		if err != nil {
+			return fmt.Errorf("failed to prepare %s: %w", path, err)
+		}
+		files = append(files, file)
+	}
+	if len(files) > 1 {
+		if err := validateAlbum(files); err != nil {
+			return err
+		}
+	}
+
+	return runAuthorized(ctx, config, func(ctx context.Context, client *telegram.Client) error {
+		api := client.API()
+
+		peer, chatID, err := resolvePeer(ctx, client, opts.Chat)
+		if err != nil {
+			return fmt.Errorf("failed to resolve chat: %w", err)
+		}
+		entities = resolveMentions(ctx, client, entities)
+
+		var scheduleDate int
+		if !opts.Schedule.IsZero() {
+			scheduleDate = int(opts.Schedule.Unix())
+		}
+		replyTo := inputReplyTo(opts.ReplyTo, opts.TopicID)
+
+		// Один файл отправляем обычным сообщением с медиа
+		if len(files) == 1 {
+			media, err := uploadToTelegram(ctx, api, files[0])
+			if err != nil {
+				return err
+			}
+
+			randomID, err := client.RandInt64()
+			if err != nil {
+				return fmt.Errorf("failed to generate random ID: %w", err)
+			}
+
+			fmt.Fprintf(os.Stderr, "Sending %s to chat %d...\n", files[0].kind, chatID)
+			updates, err := withFloodWait(ctx, func() (tg.UpdatesClass, error) {
+				return api.MessagesSendMedia(ctx, &tg.MessagesSendMediaRequest{
+					Peer:         peer,
+					Media:        media,
+					Message:      message,
+					Entities:     entities,
+					RandomID:     randomID,
+					Silent:       opts.Silent,
+					ReplyTo:      replyTo,
+					ScheduleDate: scheduleDate,
+				})
+			})
+			if err != nil {
+				return fmt.Errorf("failed to send media: %w", err)
+			}
+			if short, ok := updates.(*tg.UpdateShortSentMessage); ok {
+				updates = shortSentToUpdates(short, chatID, message, entities)
+			}
+
+			sent, err := firstMessageFromUpdates(updates, chatID)
+			if err != nil {
+				return err
+			}
+			return printJSON(sent)
+		}
+
+		// Для альбома каждый файл сначала загружается через messages.uploadMedia
+		album := make([]tg.InputSingleMedia, 0, len(files))
+		for i, file := range files {
+			media, err := uploadToTelegram(ctx, api, file)
+			if err != nil {
+				return err
+			}
+			uploaded, err := withFloodWait(ctx, func() (tg.MessageMediaClass, error) {
+				return api.MessagesUploadMedia(ctx, &tg.MessagesUploadMediaRequest{Peer: peer, Media: media})
+			})
+			if err != nil {
+				return fmt.Errorf("failed to upload media %s: %w", file.name, err)
+			}
+			inputMedia, err := uploadedToInputMedia(uploaded)
+			if err != nil {
+				return err
+			}
+
+			randomID, err := client.RandInt64()
+			if err != nil {
+				return fmt.Errorf("failed to generate random ID: %w", err)
+			}
+			single := tg.InputSingleMedia{Media: inputMedia, RandomID: randomID}
+			// Подпись альбома прикрепляется к первому файлу
+			if i == 0 {
+				single.Message = message
+				single.Entities = entities
+			}
+			album = append(album, single)
+		}
+
+		fmt.Fprintf(os.Stderr, "Sending album of %d files to chat %d...\n", len(album), chatID)
+		updates, err := withFloodWait(ctx, func() (tg.UpdatesClass, error) {
+			return api.MessagesSendMultiMedia(ctx, &tg.MessagesSendMultiMediaRequest{
+				Peer:         peer,
+				MultiMedia:   album,
+				Silent:       opts.Silent,
+				ReplyTo:      replyTo,
+				ScheduleDate: scheduleDate,
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send album: %w", err)
+		}
+
+		sent, err := extractMessages(messagesFromUpdates(updates), chatID)
+		if err != nil {
+			return fmt.Errorf("failed to extract messages: %w", err)
+		}
+		return printJSON(sent)
+	})
+}
+
+// readMessageText возвращает текст сообщения, при необходимости читая его из stdin.
+// Без текста stdin читается, только если он перенаправлен, иначе чтение зависло бы
+// в ожидании ввода с терминала
+func readMessageText(text string) (string, error) {
+	if text != "" && text != "-" {
+		return text, nil
+	}
+	if text == "" {
+		if stat, err := os.Stdin.Stat(); err == nil && stat.Mode()&os.ModeCharDevice != 0 {
+			return "", fmt.Errorf("message text is empty")
+		}
+	}
+
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("failed to read message text from stdin: %w", err)
+	}
+	return strings.TrimRight(string(data), "\n"), nil
+}
+
+// resolveMentions подставляет access hash в упоминания [имя](tg://user?id=123):
+// без него сервер не примет сущность. Пользователей, которых не нашлось среди
+// диалогов, упоминаем обычной ссылкой text_url
+func resolveMentions(ctx context.Context, client *telegram.Client, entities []tg.MessageEntityClass) []tg.MessageEntityClass {
+	users := make(map[int64]*tg.InputUser)
+	result := make([]tg.MessageEntityClass, 0, len(entities))
+	for _, e := range entities {
+		mention, ok := e.(*tg.InputMessageEntityMentionName)
+		if !ok {
+			result = append(result, e)
+			continue
+		}
+		input, ok := mention.UserID.(*tg.InputUser)
+		if !ok || input.AccessHash != 0 {
+			result = append(result, e)
+			continue
+		}
+
+		user, found := users[input.UserID]
+		if !found {
+			peer, _, err := resolvePeer(ctx, client, strconv.FormatInt(input.UserID, 10))
+			if p, ok := peer.(*tg.InputPeerUser); ok && err == nil {
+				user = &tg.InputUser{UserID: p.UserID, AccessHash: p.AccessHash}
+			} else {
+				fmt.Fprintf(os.Stderr, "User %d not found, sending the mention as a link\n", input.UserID)
+			}
+			users[input.UserID] = user
+		}
+
+		if user == nil {
+			result = append(result, &tg.MessageEntityTextURL{
+				Offset: mention.Offset,
+				Length: mention.Length,
+				URL:    "tg://user?id=" + strconv.FormatInt(input.UserID, 10),
+			})
+			continue
+		}
+		result = append(result, &tg.InputMessageEntityMentionName{
+			Offset: mention.Offset,
+			Length: mention.Length,
+			UserID: user,
+		})
+	}
+	return result
+}
+
+// inputReplyTo строит параметр ответа на сообщение и/или отправки в тему форума
+func inputReplyTo(replyToID, topicID int) tg.InputReplyToClass {
+	switch {
+	case replyToID != 0:
+		return &tg.InputReplyToMessage{ReplyToMsgID: replyToID, TopMsgID: topicID}
+	case topicID != 0:
+		// Сообщение без ответа в теме форума отправляется ответом на ее первое сообщение
+		return &tg.InputReplyToMessage{ReplyToMsgID: topicID}
+	}
+	return nil
+}
+
+// shortSentToUpdates восстанавливает полное сообщение из короткого ответа updateShortSentMessage
+func shortSentToUpdates(short *tg.UpdateShortSentMessage, chatID int64, text string, entities []tg.MessageEntityClass) tg.UpdatesClass {
+	msg := &tg.Message{
+		Out:      short.Out,
+		ID:       short.ID,
+		PeerID:   chatIDToPeer(chatID),
+		Date:     short.Date,
+		Message:  text,
+		Entities: entities,
+	}
+	if len(short.Entities) > 0 {
+		msg.Entities = short.Entities
+	}
+	if short.Media != nil {
+		msg.Media = short.Media
+	}
+	return &tg.UpdateShort{
+		Update: &tg.UpdateNewMessage{Message: msg},
+		Date:   short.Date,
+	}
+}
+
+// messagesFromUpdates собирает новые и измененные сообщения из ответа на запрос
+func messagesFromUpdates(updates tg.UpdatesClass) *tg.MessagesMessages {
+	result := &tg.MessagesMessages{}
+
+	var list []tg.UpdateClass
+	switch u := updates.(type) {
+	case *tg.Updates:
+		list = u.Updates
+		result.Users = u.Users
+		result.Chats = u.Chats
+	case *tg.UpdatesCombined:
+		list = u.Updates
+		result.Users = u.Users
+		result.Chats = u.Chats
+	case *tg.UpdateShort:
+		list = []tg.UpdateClass{u.Update}
+	}
+
+	for _, update := range list {
+		switch u := update.(type) {
+		case *tg.UpdateNewMessage:
+			result.Messages = append(result.Messages, u.Message)
+		case *tg.UpdateNewChannelMessage:
+			result.Messages = append(result.Messages, u.Message)
+		case *tg.UpdateNewScheduledMessage:
+			result.Messages = append(result.Messages, u.Message)
+		case *tg.UpdateEditMessage:
+			result.Messages = append(result.Messages, u.Message)
+		case *tg.UpdateEditChannelMessage:
+			result.Messages = append(result.Messages, u.Message)
+		}
+	}
+	return result
+}
+
+// firstMessageFromUpdates возвращает первое сообщение из ответа в виде MessageInfo
+func firstMessageFromUpdates(updates tg.UpdatesClass, chatID int64) (*MessageInfo, error) {
+	extracted, err := extractMessages(messagesFromUpdates(updates), chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract messages: %w", err)
+	}
+	if len(extracted.Messages) == 0 {
+		return nil, fmt.Errorf("response does not contain a message")
+	}
+	return &extracted.Messages[0], nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gotd/td/tg"
+)
+
+// ServiceAction описывает действие служебного сообщения
+type ServiceAction struct {
+	Action          string  `json:"action"`
+	UserIDs         []int64 `json:"user_ids,omitempty"`
+	InviterID       int64   `json:"inviter_id,omitempty"`
+	Title           string  `json:"title,omitempty"`
+	PinnedMessageID int     `json:"pinned_message_id,omitempty"`
+	ChatID          int64   `json:"chat_id,omitempty"`
+	CallID          int64   `json:"call_id,omitempty"`
+	Duration        int     `json:"duration,omitempty"`
+	Reason          string  `json:"reason,omitempty"`
+	Video           bool    `json:"video,omitempty"`
+	ScheduleDate    int     `json:"schedule_date,omitempty"`
+	TTLPeriod       int     `json:"ttl_period,omitempty"`
+	Emoticon        string  `json:"emoticon,omitempty"`
+	Message         string  `json:"message,omitempty"`
+	Currency        string  `json:"currency,omitempty"`
+	Amount          int64   `json:"amount,omitempty"`
+	Months          int     `json:"months,omitempty"`
+	GameID          int64   `json:"game_id,omitempty"`
+	Score           int     `json:"score,omitempty"`
+	Distance        int     `json:"distance,omitempty"`
+	TopicID         int     `json:"topic_id,omitempty"`
+	IconColor       int     `json:"icon_color,omitempty"`
+	IconEmojiID     int64   `json:"icon_emoji_id,omitempty"`
+	Closed          *bool   `json:"closed,omitempty"`
+	Hidden          *bool   `json:"hidden,omitempty"`
+	Domain          string  `json:"domain,omitempty"`
+}
+
+// extractServiceAction преобразует действие служебного сообщения в ServiceAction
+func extractServiceAction(msg *tg.MessageService) *ServiceAction {
+	// Закрепленное сообщение и тема форума указываются в заголовке ответа
+	var replyToMsgID, topicID int
+	if header, ok := msg.ReplyTo.(*tg.MessageReplyHeader); ok {
+		replyToMsgID = header.ReplyToMsgID
+		topicID = replyHeaderTopic(header)
+	}
+
+	switch a := msg.Action.(type) {
+	case *tg.MessageActionChatCreate:
+		return &ServiceAction{Action: "chat_create", Title: a.Title, UserIDs: a.Users}
+	case *tg.MessageActionChatEditTitle:
+		return &ServiceAction{Action: "chat_edit_title", Title: a.Title}
+	case *tg.MessageActionChatEditPhoto:
+		return &ServiceAction{Action: "chat_edit_photo"}
+	case *tg.MessageActionChatDeletePhoto:
+		return &ServiceAction{Action: "chat_delete_photo"}
+	case *tg.MessageActionChatAddUser:
+		return &ServiceAction{Action: "chat_add_user", UserIDs: a.Users}
+	case *tg.MessageActionChatDeleteUser:
+		return &ServiceAction{Action: "chat_delete_user", UserIDs: []int64{a.UserID}}
+	case *tg.MessageActionChatJoinedByLink:
+		// Вступивший по ссылке — сам отправитель сообщения
+		return &ServiceAction{Action: "chat_joined_by_link", UserIDs: serviceSenderIDs(msg), InviterID: a.InviterID}
+	case *tg.MessageActionChatJoinedByRequest:
+		return &ServiceAction{Action: "chat_joined_by_request", UserIDs: serviceSenderIDs(msg)}
+	case *tg.MessageActionChannelCreate:
+		return &ServiceAction{Action: "channel_create", Title: a.Title}
+	case *tg.MessageActionChatMigrateTo:
+		// Группа превращена в супергруппу с новым ID
+		return &ServiceAction{Action: "chat_migrate_to", ChatID: peerToChatID(&tg.PeerChannel{ChannelID: a.ChannelID})}
+	case *tg.MessageActionChannelMigrateFrom:
+		return &ServiceAction{Action: "channel_migrate_from", Title: a.Title, ChatID: peerToChatID(&tg.PeerChat{ChatID: a.ChatID})}
+	case *tg.MessageActionPinMessage:
+		return &ServiceAction{Action: "pin_message", PinnedMessageID: replyToMsgID}
+	case *tg.MessageActionHistoryClear:
+		return &ServiceAction{Action: "history_clear"}
+	case *tg.MessageActionGameScore:
+		return &ServiceAction{Action: "game_score", GameID: a.GameID, Score: a.Score}
+	case *tg.MessageActionPaymentSent:
+		return &ServiceAction{Action: "payment_sent", Currency: a.Currency, Amount: a.TotalAmount}
+	case *tg.MessageActionPaymentSentMe:
+		return &ServiceAction{Action: "payment_sent_me", Currency: a.Currency, Amount: a.TotalAmount}
+	case *tg.MessageActionPhoneCall:
+		action := &ServiceAction{Action: "phone_call", CallID: a.CallID, Duration: a.Duration, Video: a.Video}
+		if a.Reason != nil {
+			action.Reason = discardReasonName(a.Reason)
+		}
+		return action
+	case *tg.MessageActionScreenshotTaken:
+		return &ServiceAction{Action: "screenshot_taken"}
+	case *tg.MessageActionCustomAction:
+		return &ServiceAction{Action: "custom_action", Message: a.Message}
+	case *tg.MessageActionBotAllowed:
+		return &ServiceAction{Action: "bot_allowed", Domain: a.Domain}
+	case *tg.MessageActionContactSignUp:
+		return &ServiceAction{Action: "contact_sign_up"}
+	case *tg.MessageActionGeoProximityReached:
+		return &ServiceAction{
+			Action:   "geo_proximity_reached",
+			UserIDs:  []int64{peerToChatID(a.FromID), peerToChatID(a.ToID)},
+			Distance: a.Distance,
+		}
+	case *tg.MessageActionGroupCall:
+		return &ServiceAction{Action: "group_call", CallID: a.Call.ID, Duration: a.Duration}
+	case *tg.MessageActionInviteToGroupCall:
+		return &ServiceAction{Action: "invite_to_group_call", CallID: a.Call.ID, UserIDs: a.Users}
+	case *tg.MessageActionGroupCallScheduled:
+		return &ServiceAction{Action: "group_call_scheduled", CallID: a.Call.ID, ScheduleDate: a.ScheduleDate}
+	case *tg.MessageActionSetMessagesTTL:
+		return &ServiceAction{Action: "set_messages_ttl", TTLPeriod: a.Period}
+	case *tg.MessageActionSetChatTheme:
+		return &ServiceAction{Action: "set_chat_theme", Emoticon: a.Emoticon}
+	case *tg.MessageActionGiftPremium:
+		return &ServiceAction{Action: "gift_premium", Currency: a.Currency, Amount: a.Amount, Months: a.Months}
+	case *tg.MessageActionTopicCreate:
+		return &ServiceAction{
+			Action:      "topic_create",
+			Title:       a.Title,
+			TopicID:     msg.ID,
+			IconColor:   a.IconColor,
+			IconEmojiID: a.IconEmojiID,
+		}
+	case *tg.MessageActionTopicEdit:
+		action := &ServiceAction{Action: "topic_edit", Title: a.Title, TopicID: topicID, IconEmojiID: a.IconEmojiID}
+		if closed, ok := a.GetClosed(); ok {
+			action.Closed = &closed
+		}
+		if hidden, ok := a.GetHidden(); ok {
+			action.Hidden = &hidden
+		}
+		return action
+	case *tg.MessageActionSuggestProfilePhoto:
+		return &ServiceAction{Action: "suggest_profile_photo"}
+	case *tg.MessageActionSetChatWallPaper:
+		return &ServiceAction{Action: "set_chat_wallpaper"}
+	case *tg.MessageActionWebViewDataSent:
+		return &ServiceAction{Action: "web_view_data_sent", Message: a.Text}
+	case *tg.MessageActionGiveawayLaunch:
+		return &ServiceAction{Action: "giveaway_launch"}
+	case *tg.MessageActionEmpty, nil:
+		return &ServiceAction{Action: "empty"}
+	}
+
+	// Для новых действий выводим имя типа без префикса
+	name := strings.TrimPrefix(fmt.Sprintf("%T", msg.Action), "*tg.MessageAction")
+	return &ServiceAction{Action: "unknown_" + strings.ToLower(name)}
+}
+
+// serviceSenderIDs возвращает пользователя, отправившего служебное сообщение
+func serviceSenderIDs(msg *tg.MessageService) []int64 {
+	if from, ok := msg.FromID.(*tg.PeerUser); ok {
+		return []int64{from.UserID}
+	}
+	return nil
+}
+
+// discardReasonName возвращает причину завершения звонка
+func discardReasonName(reason tg.PhoneCallDiscardReasonClass) string {
+	switch reason.(type) {
+	case *tg.PhoneCallDiscardReasonMissed:
+		return "missed"
+	case *tg.PhoneCallDiscardReasonDisconnect:
+		return "disconnect"
+	case *tg.PhoneCallDiscardReasonHangup:
+		return "hangup"
+	case *tg.PhoneCallDiscardReasonBusy:
+		return "busy"
+	}
+	return "unknown"
+}
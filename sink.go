@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Типы приемников событий для --sink
+const (
+	SinkStdout  = "stdout"
+	SinkWebhook = "webhook"
+	SinkNATS    = "nats"
+	SinkKafka   = "kafka"
+	SinkRedis   = "redis"
+	SinkFile    = "file"   // --sink file:///path/events.ndjson
+	SinkSQLite  = "sqlite" // --sink sqlite:///path/events.db
+)
+
+// sinkDrainTimeout сколько ждать доставки оставшихся событий при остановке
+const sinkDrainTimeout = 30 * time.Second
+
+// EventSink принимает события для доставки во внешнюю систему.
+// Send возвращает nil, только когда событие доставлено или надежно сохранено
+// (например, в дисковую очередь): после этого состояние обновлений сдвигается
+// и событие не придет повторно. Ошибка Send останавливает отслеживание.
+// Close дожидается доставки уже принятых событий или истечения ctx.
+// Новый приемник достаточно реализовать и добавить в newEventSink
+type EventSink interface {
+	Send(ctx context.Context, event EventInfo) error
+	Close(ctx context.Context) error
+}
+
+// SinkOptions задает приемник событий и его параметры
+type SinkOptions struct {
+	Type       string          // stdout, webhook, nats, kafka, redis, file или sqlite
+	Webhook    WebhookOptions  // Параметры для webhook
+	Broker     BrokerOptions   // Параметры для nats, kafka и redis
+	File       FileSinkOptions // Параметры для file
+	SQLitePath string          // Файл базы для sqlite
+}
+
+// parseSinkSpec разбирает значение --sink: тип приемника или URL вида file:///path и sqlite:///path
+func parseSinkSpec(spec string) (sinkType, path string) {
+	for _, t := range []string{SinkFile, SinkSQLite} {
+		if rest, ok := strings.CutPrefix(spec, t+"://"); ok {
+			return t, rest
+		}
+	}
+	return spec, ""
+}
+
+// newEventSink создает приемник событий; account — ID аккаунта для шаблонов subject
+func newEventSink(ctx context.Context, opts SinkOptions, account int64) (EventSink, error) {
+	switch opts.Type {
+	case SinkStdout, "":
+		return instrumentedSink{SinkStdout, stdoutSink{}}, nil
+	case SinkWebhook:
+		return newWebhookSink(opts.Webhook)
+	case SinkNATS:
+		publisher, err := newNATSPublisher(opts.Broker)
+		if err != nil {
+			return nil, err
+		}
+		return newBrokerSink("NATS", SinkNATS, publisher, withDefaultSubject(opts.Broker, defaultSubjectNATS), account)
+	case SinkKafka:
+		return newBrokerSink("Kafka", SinkKafka, newKafkaPublisher(opts.Broker), withDefaultSubject(opts.Broker, defaultSubjectKafka), account)
+	case SinkRedis:
+		publisher, err := newRedisPublisher(ctx, opts.Broker)
+		if err != nil {
+			return nil, err
+		}
+		return newBrokerSink("Redis", SinkRedis, publisher, withDefaultSubject(opts.Broker, defaultSubjectRedis), account)
+	case SinkFile:
+		sink, err := newFileSink(opts.File)
+		if err != nil {
+			return nil, err
+		}
+		return instrumentedSink{SinkFile, sink}, nil
+	case SinkSQLite:
+		sink, err := newSQLiteSink(ctx, opts.SQLitePath)
+		if err != nil {
+			return nil, err
+		}
+		return instrumentedSink{SinkSQLite, sink}, nil
+	}
+	return nil, fmt.Errorf("unknown sink %q", opts.Type)
+}
+
+// withDefaultSubject подставляет шаблон по умолчанию для выбранного брокера
+func withDefaultSubject(opts BrokerOptions, subject string) BrokerOptions {
+	if opts.Subject == "" {
+		opts.Subject = subject
+	}
+	return opts
+}
+
+// stdoutSink выводит события в stdout по одному JSON на строку
+type stdoutSink struct{}
+
+func (stdoutSink) Send(ctx context.Context, event EventInfo) error {
+	return outputEvent(event)
+}
+
+func (stdoutSink) Close(ctx context.Context) error {
+	return nil
+}
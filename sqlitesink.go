@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema нормализованная схема архива событий. Сообщения хранятся в
+// последней известной версии: правки обновляют text/data и пишутся в edits,
+// удаления проставляют deleted_at и пишутся в deletes. Прочие события
+// (действия в чатах, прочтения, набор текста) сохраняются в events как есть
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS messages (
+	chat_id    INTEGER NOT NULL,
+	message_id INTEGER NOT NULL,
+	chat_type  TEXT,
+	chat_title TEXT,
+	user_id    INTEGER,
+	username   TEXT,
+	date       INTEGER NOT NULL,
+	text       TEXT,
+	media_type TEXT,
+	reply_to   INTEGER,
+	topic_id   INTEGER,
+	outgoing   INTEGER NOT NULL DEFAULT 0,
+	edit_date  INTEGER,
+	deleted_at INTEGER,
+	data       TEXT NOT NULL,
+	PRIMARY KEY (chat_id, message_id)
+);
+CREATE INDEX IF NOT EXISTS messages_date ON messages (date);
+CREATE INDEX IF NOT EXISTS messages_user ON messages (user_id);
+
+CREATE TABLE IF NOT EXISTS edits (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	chat_id     INTEGER NOT NULL,
+	message_id  INTEGER NOT NULL,
+	edit_date   INTEGER NOT NULL,
+	text        TEXT,
+	data        TEXT NOT NULL,
+	received_at INTEGER NOT NULL,
+	UNIQUE (chat_id, message_id, edit_date)
+);
+
+CREATE TABLE IF NOT EXISTS deletes (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	chat_id    INTEGER NOT NULL,
+	message_id INTEGER NOT NULL,
+	deleted_at INTEGER NOT NULL,
+	UNIQUE (chat_id, message_id)
+);
+
+CREATE TABLE IF NOT EXISTS statuses (
+	id       INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id  INTEGER NOT NULL,
+	username TEXT,
+	status   TEXT NOT NULL,
+	time     INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS statuses_user ON statuses (user_id, time);
+
+CREATE TABLE IF NOT EXISTS events (
+	id      INTEGER PRIMARY KEY AUTOINCREMENT,
+	type    TEXT NOT NULL,
+	time    INTEGER NOT NULL,
+	chat_id INTEGER,
+	user_id INTEGER,
+	action  TEXT,
+	data    TEXT NOT NULL
+);
+`
+
+// sqliteSink записывает события в базу SQLite синхронно, каждое в своей транзакции
+type sqliteSink struct {
+	db *sql.DB
+}
+
+// newSQLiteSink открывает базу и создает схему при необходимости
+func newSQLiteSink(ctx context.Context, path string) (*sqliteSink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("sqlite sink path is empty")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=synchronous(NORMAL)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	// Один писатель: SQLite все равно сериализует запись
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.ExecContext(ctx, sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create database schema: %w", err)
+	}
+	return &sqliteSink{db: db}, nil
+}
+
+func (s *sqliteSink) Send(ctx context.Context, event EventInfo) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	switch event.Type {
+	case EventMessage:
+		err = s.insertMessage(ctx, tx, &event)
+	case EventEdit:
+		err = s.applyEdit(ctx, tx, &event)
+	case EventDelete:
+		err = s.applyDelete(ctx, tx, &event)
+	case EventUserStatus:
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO statuses (user_id, username, status, time) VALUES (?, ?, ?, ?)`,
+			event.UserID, event.Username, event.Action, event.Time)
+	default:
+		err = s.insertEvent(ctx, tx, &event)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store %s event: %w", event.Type, err)
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteSink) Close(ctx context.Context) error {
+	return s.db.Close()
+}
+
+// insertMessage сохраняет новое сообщение; повторно полученное после перезапуска пропускается
+func (s *sqliteSink) insertMessage(ctx context.Context, tx *sql.Tx, event *EventInfo) error {
+	info, data, err := eventMessageData(event)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO messages (chat_id, message_id, chat_type, chat_title, user_id, username,
+			date, text, media_type, reply_to, topic_id, outgoing, edit_date, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (chat_id, message_id) DO NOTHING`,
+		event.ChatID, event.MessageID, event.ChatType, event.ChatTitle, event.UserID, event.Username,
+		info.Date, info.Text, info.MediaType, info.ReplyToMsgID, info.TopicID, info.IsOutgoing,
+		nullInt(info.EditDate), data)
+	return err
+}
+
+// applyEdit записывает правку и обновляет сохраненное сообщение; если его нет, оно добавляется
+func (s *sqliteSink) applyEdit(ctx context.Context, tx *sql.Tx, event *EventInfo) error {
+	info, data, err := eventMessageData(event)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT OR IGNORE INTO edits (chat_id, message_id, edit_date, text, data, received_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		event.ChatID, event.MessageID, info.EditDate, info.Text, data, event.Time); err != nil {
+		return err
+	}
+
+	// Более старая правка, пришедшая после новой, сообщение не откатывает
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO messages (chat_id, message_id, chat_type, chat_title, user_id, username,
+			date, text, media_type, reply_to, topic_id, outgoing, edit_date, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (chat_id, message_id) DO UPDATE SET
+			text = excluded.text,
+			media_type = excluded.media_type,
+			edit_date = excluded.edit_date,
+			data = excluded.data
+		WHERE COALESCE(messages.edit_date, 0) <= excluded.edit_date`,
+		event.ChatID, event.MessageID, event.ChatType, event.ChatTitle, event.UserID, event.Username,
+		info.Date, info.Text, info.MediaType, info.ReplyToMsgID, info.TopicID, info.IsOutgoing,
+		info.EditDate, data)
+	return err
+}
+
+// applyDelete помечает сообщения удаленными. Удаления в личных чатах и обычных
+// группах приходят без чата (chat_id = 0): ID таких сообщений уникальны в пределах
+// аккаунта, поэтому они ищутся среди всех чатов, кроме каналов и супергрупп
+func (s *sqliteSink) applyDelete(ctx context.Context, tx *sql.Tx, event *EventInfo) error {
+	var messageIDs []int
+	if err := json.Unmarshal(event.RawData, &messageIDs); err != nil {
+		return fmt.Errorf("invalid message IDs: %w", err)
+	}
+
+	for _, id := range messageIDs {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT OR IGNORE INTO deletes (chat_id, message_id, deleted_at) VALUES (?, ?, ?)`,
+			event.ChatID, id, event.Time); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE messages SET deleted_at = ?
+			WHERE message_id = ? AND deleted_at IS NULL
+				AND (chat_id = ? OR (? = 0 AND chat_type NOT IN ('channel', 'supergroup')))`,
+			event.Time, id, event.ChatID, event.ChatID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertEvent сохраняет событие без отдельной таблицы целиком в JSON
+func (s *sqliteSink) insertEvent(ctx context.Context, tx *sql.Tx, event *EventInfo) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO events (type, time, chat_id, user_id, action, data) VALUES (?, ?, ?, ?, ?, ?)`,
+		string(event.Type), event.Time, nullInt64(event.ChatID), nullInt64(event.UserID), event.Action, string(data))
+	return err
+}
+
+// eventMessageData возвращает сообщение события и его JSON для колонки data
+func eventMessageData(event *EventInfo) (*MessageInfo, string, error) {
+	info := event.Details
+	if info == nil {
+		// Без подробностей сохраняем то, что есть в самом событии
+		info = &MessageInfo{ID: event.MessageID, ChatID: event.ChatID, Date: int(event.Time), Text: event.Message, TopicID: event.TopicID}
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, "", err
+	}
+	return info, string(data), nil
+}
+
+// nullInt превращает нулевое значение в NULL
+func nullInt(v int) any {
+	if v == 0 {
+		return nil
+	}
+	return v
+}
+
+// nullInt64 превращает нулевое значение в NULL
+func nullInt64(v int64) any {
+	if v == 0 {
+		return nil
+	}
+	return v
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+)
+
+// TopicsOptions задает параметры выборки тем форума
+type TopicsOptions struct {
+	Chat  string // Супергруппа с темами: ID или @username
+	Query string // Поиск тем по названию
+	Limit int    // Максимальное количество тем
+}
+
+// TopicInfo содержит информацию о теме форума
+type TopicInfo struct {
+	ID                   int    `json:"id"`
+	Title                string `json:"title"`
+	IconColor            int    `json:"icon_color,omitempty"`
+	IconEmojiID          int64  `json:"icon_emoji_id,omitempty"`
+	Date                 int    `json:"date"`
+	CreatorID            int64  `json:"creator_id,omitempty"`
+	TopMessage           int    `json:"top_message,omitempty"`
+	UnreadCount          int    `json:"unread_count"`
+	UnreadMentionsCount  int    `json:"unread_mentions_count,omitempty"`
+	UnreadReactionsCount int    `json:"unread_reactions_count,omitempty"`
+	ReadInboxMaxID       int    `json:"read_inbox_max_id,omitempty"`
+	ReadOutboxMaxID      int    `json:"read_outbox_max_id,omitempty"`
+	Closed               bool   `json:"closed,omitempty"`
+	Pinned               bool   `json:"pinned,omitempty"`
+	Hidden               bool   `json:"hidden,omitempty"`
+	My                   bool   `json:"my,omitempty"`
+}
+
+// TopicsResponse содержит список тем форума для вывода в JSON
+type TopicsResponse struct {
+	Topics []TopicInfo `json:"topics"`
+	Count  int         `json:"count"`
+	Total  int         `json:"total"`
+	ChatID int64       `json:"chat_id"`
+}
+
+// GetTopics выводит темы форума супергруппы
+func GetTopics(ctx context.Context, config AuthConfig, opts TopicsOptions) error {
+	return runAuthorized(ctx, config, func(ctx context.Context, client *telegram.Client) error {
+		api := client.API()
+
+		peer, chatID, err := resolvePeer(ctx, client, opts.Chat)
+		if err != nil {
+			return fmt.Errorf("failed to resolve chat: %w", err)
+		}
+		channel, ok := inputChannelFromPeer(peer)
+		if !ok {
+			return fmt.Errorf("chat %d is not a supergroup with topics", chatID)
+		}
+
+		fmt.Fprintf(os.Stderr, "Getting forum topics of chat %d...\n", chatID)
+		result := &TopicsResponse{
+			Topics: make([]TopicInfo, 0, opts.Limit),
+			ChatID: chatID,
+		}
+
+		// Темы отдаются страницами; следующая начинается после последней темы предыдущей
+		var offsetDate, offsetID, offsetTopic int
+		for len(result.Topics) < opts.Limit {
+			batch := opts.Limit - len(result.Topics)
+			if batch > historyBatchSize {
+				batch = historyBatchSize
+			}
+
+			page, err := withFloodWait(ctx, func() (*tg.MessagesForumTopics, error) {
+				return api.ChannelsGetForumTopics(ctx, &tg.ChannelsGetForumTopicsRequest{
+					Channel:     channel,
+					Q:           opts.Query,
+					OffsetDate:  offsetDate,
+					OffsetID:    offsetID,
+					OffsetTopic: offsetTopic,
+					Limit:       batch,
+				})
+			})
+			if err != nil {
+				return fmt.Errorf("failed to get forum topics: %w", err)
+			}
+			result.Total = page.Count
+
+			var last *tg.ForumTopic
+			for _, t := range page.Topics {
+				topic, ok := t.(*tg.ForumTopic)
+				if !ok {
+					continue
+				}
+				result.Topics = append(result.Topics, extractTopic(topic))
+				last = topic
+			}
+			if last == nil || len(page.Topics) < batch {
+				break
+			}
+
+			// Дата смещения берется из последнего сообщения последней темы
+			offsetDate, offsetID, offsetTopic = 0, last.TopMessage, last.ID
+			for _, m := range page.Messages {
+				if id, date := messageIDAndDate(m); id == last.TopMessage {
+					offsetDate = date
+				}
+			}
+		}
+		result.Count = len(result.Topics)
+
+		return printJSON(result)
+	})
+}
+
+// extractTopic преобразует тему форума в TopicInfo
+func extractTopic(topic *tg.ForumTopic) TopicInfo {
+	info := TopicInfo{
+		ID:                   topic.ID,
+		Title:                topic.Title,
+		IconColor:            topic.IconColor,
+		IconEmojiID:          topic.IconEmojiID,
+		Date:                 topic.Date,
+		TopMessage:           topic.TopMessage,
+		UnreadCount:          topic.UnreadCount,
+		UnreadMentionsCount:  topic.UnreadMentionsCount,
+		UnreadReactionsCount: topic.UnreadReactionsCount,
+		ReadInboxMaxID:       topic.ReadInboxMaxID,
+		ReadOutboxMaxID:      topic.ReadOutboxMaxID,
+		Closed:               topic.Closed,
+		Pinned:               topic.Pinned,
+		Hidden:               topic.Hidden,
+		My:                   topic.My,
+	}
+	if topic.FromID != nil {
+		info.CreatorID = peerToChatID(topic.FromID)
+	}
+	return info
+}
+
+// messageTopicID возвращает ID темы форума, к которой относится сообщение
+func messageTopicID(msg *tg.Message) int {
+	header, ok := msg.ReplyTo.(*tg.MessageReplyHeader)
+	if !ok {
+		return 0
+	}
+	return replyHeaderTopic(header)
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/telegram/updates"
+)
+
+// stateSaveDelay на сколько откладывается запись состояния: pts меняется с каждым
+// обновлением, и без задержки файл переписывался бы на каждое событие. При аварийном
+// завершении теряется не больше этого интервала, и эти события придут повторно
+const stateSaveDelay = time.Second
+
+var (
+	// errStateNotFound возвращается при изменении состояния, которое еще не сохранено
+	errStateNotFound = errors.New("update state not found")
+	// errStateFrozen возвращается при изменении состояния после freeze
+	errStateFrozen = errors.New("update state is frozen after a delivery failure")
+)
+
+// accountUpdateState содержит сохраненное состояние обновлений одного аккаунта
+type accountUpdateState struct {
+	Pts          int             `json:"pts"`
+	Qts          int             `json:"qts"`
+	Date         int             `json:"date"`
+	Seq          int             `json:"seq"`
+	Saved        bool            `json:"saved"`
+	Channels     map[int64]int   `json:"channels"`      // pts по каждому каналу
+	AccessHashes map[int64]int64 `json:"access_hashes"` // access hash каналов для getChannelDifference
+}
+
+// fileStateStorage хранит pts/qts/date/seq и pts каналов в JSON-файле,
+// чтобы после перезапуска менеджер обновлений догнал пропущенное через getDifference
+type fileStateStorage struct {
+	path     string
+	mux      sync.Mutex
+	accounts map[int64]*accountUpdateState
+	frozen   bool        // Состояние больше не сдвигается: событие не доставлено и должно прийти снова
+	dirty    bool        // Есть изменения, еще не записанные на диск
+	timer    *time.Timer // Отложенная запись
+}
+
+var (
+	_ updates.StateStorage        = (*fileStateStorage)(nil)
+	_ updates.ChannelAccessHasher = (*fileStateStorage)(nil)
+)
+
+// openFileStateStorage загружает состояние из файла; отсутствующий файл означает пустое состояние
+func openFileStateStorage(path string) (*fileStateStorage, error) {
+	s := &fileStateStorage{
+		path:     path,
+		accounts: map[int64]*accountUpdateState{},
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read update state: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.accounts); err != nil {
+		return nil, fmt.Errorf("failed to parse update state %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// account возвращает состояние аккаунта, создавая его при необходимости
+func (s *fileStateStorage) account(userID int64) *accountUpdateState {
+	acc, ok := s.accounts[userID]
+	if !ok {
+		acc = &accountUpdateState{}
+		s.accounts[userID] = acc
+	}
+	if acc.Channels == nil {
+		acc.Channels = map[int64]int{}
+	}
+	if acc.AccessHashes == nil {
+		acc.AccessHashes = map[int64]int64{}
+	}
+	return acc
+}
+
+// scheduleSave откладывает запись изменений на stateSaveDelay
+func (s *fileStateStorage) scheduleSave() {
+	s.dirty = true
+	if s.timer == nil {
+		s.timer = time.AfterFunc(stateSaveDelay, s.flush)
+	}
+}
+
+// flush записывает отложенные изменения по таймеру; при ошибке они останутся до следующей записи
+func (s *fileStateStorage) flush() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.timer = nil
+	if err := s.save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+// close записывает отложенные изменения; вызывается после остановки менеджера обновлений
+func (s *fileStateStorage) close() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	return s.save()
+}
+
+// save атомарно записывает изменения на диск через временный файл, сброшенный
+// на диск до переименования: иначе после сбоя питания файл мог бы оказаться пустым
+func (s *fileStateStorage) save() error {
+	if !s.dirty {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.accounts, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize update state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to save update state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save update state: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save update state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save update state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to save update state: %w", err)
+	}
+	s.dirty = false
+	return nil
+}
+
+// freeze запрещает дальнейшие изменения pts/qts/seq. Менеджер обновлений
+// сохраняет pts после вызова обработчика, поэтому freeze, вызванный из
+// обработчика, не дает записать состояние дальше недоставленного события
+func (s *fileStateStorage) freeze() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.frozen = true
+}
+
+// update изменяет сохраненное состояние аккаунта и откладывает его запись
+func (s *fileStateStorage) update(userID int64, apply func(acc *accountUpdateState)) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.frozen {
+		return errStateFrozen
+	}
+	acc, ok := s.accounts[userID]
+	if !ok || !acc.Saved {
+		return errStateNotFound
+	}
+	apply(acc)
+	s.scheduleSave()
+	return nil
+}
+
+func (s *fileStateStorage) GetState(ctx context.Context, userID int64) (updates.State, bool, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	acc, ok := s.accounts[userID]
+	if !ok || !acc.Saved {
+		return updates.State{}, false, nil
+	}
+	return updates.State{Pts: acc.Pts, Qts: acc.Qts, Date: acc.Date, Seq: acc.Seq}, true, nil
+}
+
+func (s *fileStateStorage) SetState(ctx context.Context, userID int64, state updates.State) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.frozen {
+		return errStateFrozen
+	}
+
+	// Новое общее состояние делает pts каналов неактуальными; access hash остаются
+	acc := s.account(userID)
+	acc.Pts, acc.Qts, acc.Date, acc.Seq = state.Pts, state.Qts, state.Date, state.Seq
+	acc.Saved = true
+	acc.Channels = map[int64]int{}
+	s.scheduleSave()
+	return nil
+}
+
+func (s *fileStateStorage) SetPts(ctx context.Context, userID int64, pts int) error {
+	return s.update(userID, func(acc *accountUpdateState) { acc.Pts = pts })
+}
+
+func (s *fileStateStorage) SetQts(ctx context.Context, userID int64, qts int) error {
+	return s.update(userID, func(acc *accountUpdateState) { acc.Qts = qts })
+}
+
+func (s *fileStateStorage) SetDate(ctx context.Context, userID int64, date int) error {
+	return s.update(userID, func(acc *accountUpdateState) { acc.Date = date })
+}
+
+func (s *fileStateStorage) SetSeq(ctx context.Context, userID int64, seq int) error {
+	return s.update(userID, func(acc *accountUpdateState) { acc.Seq = seq })
+}
+
+func (s *fileStateStorage) SetDateSeq(ctx context.Context, userID int64, date, seq int) error {
+	return s.update(userID, func(acc *accountUpdateState) { acc.Date, acc.Seq = date, seq })
+}
+
+func (s *fileStateStorage) GetChannelPts(ctx context.Context, userID, channelID int64) (int, bool, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	acc, ok := s.accounts[userID]
+	if !ok {
+		return 0, false, nil
+	}
+	pts, ok := acc.Channels[channelID]
+	return pts, ok, nil
+}
+
+func (s *fileStateStorage) SetChannelPts(ctx context.Context, userID, channelID int64, pts int) error {
+	return s.update(userID, func(acc *accountUpdateState) {
+		if acc.Channels == nil {
+			acc.Channels = map[int64]int{}
+		}
+		acc.Channels[channelID] = pts
+	})
+}
+
+func (s *fileStateStorage) ForEachChannels(ctx context.Context, userID int64, f func(ctx context.Context, channelID int64, pts int) error) error {
+	// Копируем pts под блокировкой: обработчик может сам менять состояние
+	s.mux.Lock()
+	channels := map[int64]int{}
+	if acc, ok := s.accounts[userID]; ok {
+		for id, pts := range acc.Channels {
+			channels[id] = pts
+		}
+	}
+	s.mux.Unlock()
+
+	for id, pts := range channels {
+		if err := f(ctx, id, pts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fileStateStorage) GetChannelAccessHash(ctx context.Context, userID, channelID int64) (int64, bool, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	acc, ok := s.accounts[userID]
+	if !ok {
+		return 0, false, nil
+	}
+	hash, ok := acc.AccessHashes[channelID]
+	return hash, ok, nil
+}
+
+func (s *fileStateStorage) SetChannelAccessHash(ctx context.Context, userID, channelID, accessHash int64) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	acc := s.account(userID)
+	if acc.AccessHashes[channelID] == accessHash {
+		return nil
+	}
+	acc.AccessHashes[channelID] = accessHash
+	s.scheduleSave()
+	return nil
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gotd/td/telegram/uploader"
+	"github.com/gotd/td/tg"
+)
+
+// maxAlbumFiles максимальное количество файлов в одном альбоме
+const maxAlbumFiles = 10
+
+// Виды отправляемых файлов
+const (
+	UploadAsPhoto    = "photo"
+	UploadAsVideo    = "video"
+	UploadAsDocument = "document"
+	UploadAsVoice    = "voice"
+	UploadAsAudio    = "audio"
+)
+
+// uploadFile описывает подготовленный к отправке файл
+type uploadFile struct {
+	path     string
+	name     string
+	mimeType string
+	kind     string
+	meta     mediaMeta
+	temp     bool
+}
+
+// mediaMeta содержит метаданные видео и аудио для атрибутов документа
+type mediaMeta struct {
+	duration  float64
+	width     int
+	height    int
+	title     string
+	performer string
+}
+
+// prepareUpload определяет имя, MIME-тип, вид и метаданные файла; "-" означает чтение из stdin
+func prepareUpload(path, as, stdinName string) (*uploadFile, error) {
+	file := &uploadFile{path: path, name: filepath.Base(path)}
+
+	// Stdin сохраняем во временный файл, чтобы знать размер и определить тип
+	if path == "-" {
+		tmp, err := os.CreateTemp("", "tg-upload-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temporary file: %w", err)
+		}
+		if _, err := io.Copy(tmp, os.Stdin); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return nil, fmt.Errorf("failed to read file from stdin: %w", err)
+		}
+		if err := tmp.Close(); err != nil {
+			os.Remove(tmp.Name())
+			return nil, fmt.Errorf("failed to write temporary file: %w", err)
+		}
+		file.path = tmp.Name()
+		file.name = stdinName
+		file.temp = true
+	}
+
+	mimeType, err := detectMimeType(file.path, file.name)
+	if err != nil {
+		file.cleanup()
+		return nil, err
+	}
+	file.mimeType = mimeType
+
+	// Имя для stdin без расширения дополняем по MIME-типу
+	if file.name == "" {
+		file.name = "file"
+	}
+	if filepath.Ext(file.name) == "" {
+		if exts, err := mime.ExtensionsByType(mimeType); err == nil && len(exts) > 0 {
+			file.name += exts[0]
+		}
+	}
+
+	file.kind = as
+	if file.kind == "" {
+		file.kind = uploadKindByMime(mimeType)
+	}
+
+	// Длительность и размеры нужны Telegram для корректного отображения плеера:
+	// видео без них показывается искаженным, поэтому без метаданных его не отправляем
+	if file.kind == UploadAsVideo || file.kind == UploadAsAudio || file.kind == UploadAsVoice {
+		meta, err := probeMediaMeta(file.path)
+		switch {
+		case err == nil:
+			file.meta = meta
+		case file.kind == UploadAsVideo && as == UploadAsVideo:
+			file.cleanup()
+			return nil, fmt.Errorf("cannot send as video: %w", err)
+		case file.kind == UploadAsVideo:
+			fmt.Fprintf(os.Stderr, "Warning: %v; sending %s as a document\n", err, file.name)
+			file.kind = UploadAsDocument
+		default:
+			fmt.Fprintf(os.Stderr, "Warning: %v; sending %s without duration\n", err, file.name)
+		}
+	}
+	return file, nil
+}
+
+// cleanup удаляет временный файл, созданный для stdin
+func (f *uploadFile) cleanup() {
+	if f.temp {
+		os.Remove(f.path)
+	}
+}
+
+// detectMimeType определяет MIME-тип по расширению или содержимому файла
+func detectMimeType(path, name string) (string, error) {
+	if mimeType := mime.TypeByExtension(filepath.Ext(name)); mimeType != "" {
+		return strings.TrimSpace(strings.Split(mimeType, ";")[0]), nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := f.Read(head)
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	return strings.TrimSpace(strings.Split(http.DetectContentType(head[:n]), ";")[0]), nil
+}
+
+// uploadKindByMime выбирает вид отправки по MIME-типу
+func uploadKindByMime(mimeType string) string {
+	switch {
+	case mimeType == "image/jpeg" || mimeType == "image/png":
+		return UploadAsPhoto
+	case strings.HasPrefix(mimeType, "video/"):
+		return UploadAsVideo
+	case strings.HasPrefix(mimeType, "audio/"):
+		return UploadAsAudio
+	default:
+		return UploadAsDocument
+	}
+}
+
+// probeMediaMeta читает метаданные видео и аудио через ffprobe
+func probeMediaMeta(path string) (mediaMeta, error) {
+	ffprobe, err := exec.LookPath("ffprobe")
+	if err != nil {
+		return mediaMeta{}, fmt.Errorf("ffprobe is not installed, media metadata is unknown")
+	}
+
+	out, err := exec.Command(ffprobe, "-v", "quiet", "-print_format", "json", "-show_format", "-show_streams", path).Output()
+	if err != nil {
+		return mediaMeta{}, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	var probe struct {
+		Format struct {
+			Duration string            `json:"duration"`
+			Tags     map[string]string `json:"tags"`
+		} `json:"format"`
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+			Width     int    `json:"width"`
+			Height    int    `json:"height"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return mediaMeta{}, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+
+	var meta mediaMeta
+	meta.duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	for _, stream := range probe.Streams {
+		if stream.CodecType == "video" && stream.Width > 0 {
+			meta.width, meta.height = stream.Width, stream.Height
+			break
+		}
+	}
+	for key, value := range probe.Format.Tags {
+		switch strings.ToLower(key) {
+		case "title":
+			meta.title = value
+		case "artist":
+			meta.performer = value
+		}
+	}
+	return meta, nil
+}
+
+// validateAlbum проверяет, что файлы можно отправить одним альбомом: фото и видео
+// смешиваются между собой, документы и аудио группируются только с файлами своего вида
+func validateAlbum(files []*uploadFile) error {
+	group := func(kind string) string {
+		if kind == UploadAsPhoto || kind == UploadAsVideo {
+			return "photos and videos"
+		}
+		return kind + "s"
+	}
+
+	for _, file := range files {
+		if file.kind == UploadAsVoice {
+			return fmt.Errorf("voice messages cannot be sent as an album")
+		}
+		if first := group(files[0].kind); group(file.kind) != first {
+			return fmt.Errorf("album cannot mix %s (%s) with %s (%s)", first, files[0].name, group(file.kind), file.name)
+		}
+	}
+	return nil
+}
+
+// inputMedia строит InputMedia для загруженного файла
+func (f *uploadFile) inputMedia(file tg.InputFileClass) tg.InputMediaClass {
+	if f.kind == UploadAsPhoto {
+		return &tg.InputMediaUploadedPhoto{File: file}
+	}
+
+	attributes := []tg.DocumentAttributeClass{
+		&tg.DocumentAttributeFilename{FileName: f.name},
+	}
+	switch f.kind {
+	case UploadAsVideo:
+		attributes = append(attributes, &tg.DocumentAttributeVideo{
+			SupportsStreaming: true,
+			Duration:          f.meta.duration,
+			W:                 f.meta.width,
+			H:                 f.meta.height,
+		})
+	case UploadAsAudio, UploadAsVoice:
+		attributes = append(attributes, &tg.DocumentAttributeAudio{
+			Voice:     f.kind == UploadAsVoice,
+			Duration:  int(f.meta.duration),
+			Title:     f.meta.title,
+			Performer: f.meta.performer,
+		})
+	}
+
+	return &tg.InputMediaUploadedDocument{
+		File:       file,
+		MimeType:   f.mimeType,
+		Attributes: attributes,
+		ForceFile:  f.kind == UploadAsDocument,
+	}
+}
+
+// uploadProgress выводит прогресс загрузки файла в stderr
+type uploadProgress struct{}
+
+// Chunk реализует uploader.Progress
+func (uploadProgress) Chunk(_ context.Context, state uploader.ProgressState) error {
+	if state.Total > 0 {
+		fmt.Fprintf(os.Stderr, "\rUploading %s: %d%% (%d/%d bytes)", state.Name, state.Uploaded*100/state.Total, state.Uploaded, state.Total)
+		if state.Uploaded >= state.Total {
+			fmt.Fprintln(os.Stderr)
+		}
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "\rUploading %s: %d bytes", state.Name, state.Uploaded)
+	return nil
+}
+
+// uploadToTelegram загружает файл на сервер Telegram и возвращает InputMedia для отправки
+func uploadToTelegram(ctx context.Context, api *tg.Client, file *uploadFile) (tg.InputMediaClass, error) {
+	f, err := os.Open(file.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	// Большие файлы uploader автоматически загружает через upload.saveBigFilePart
+	up := uploader.NewUploader(api).WithProgress(uploadProgress{})
+	inputFile, err := up.Upload(ctx, uploader.NewUpload(file.name, f, stat.Size()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload %s: %w", file.name, err)
+	}
+	return file.inputMedia(inputFile), nil
+}
+
+// uploadedToInputMedia превращает загруженное через messages.uploadMedia медиа в InputMedia для альбома
+func uploadedToInputMedia(media tg.MessageMediaClass) (tg.InputMediaClass, error) {
+	switch m := media.(type) {
+	case *tg.MessageMediaPhoto:
+		if photo, ok := m.Photo.(*tg.Photo); ok {
+			return &tg.InputMediaPhoto{ID: photo.AsInput()}, nil
+		}
+	case *tg.MessageMediaDocument:
+		if doc, ok := m.Document.(*tg.Document); ok {
+			return &tg.InputMediaDocument{ID: doc.AsInput()}, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected type of uploaded media: %T", media)
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+const (
+	webhookQueueRetryInterval = 30 * time.Second // Через сколько повторять доставку из очереди после неудачи
+)
+
+// WebhookOptions задает доставку событий HTTP POST-запросами
+type WebhookOptions struct {
+	URL           string        // Адрес, на который отправляются события
+	Secret        string        // Ключ подписи HMAC-SHA256; пустой отключает подпись
+	Headers       []string      // Дополнительные заголовки в формате "Name: value"
+	Timeout       time.Duration // Таймаут одного запроса
+	RetryTime     time.Duration // Сколько повторять неудачную доставку с экспоненциальной задержкой
+	QueueDir      string        // Каталог очереди; пустой — события отправляются синхронно по одному
+	BatchSize     int           // Сколько событий отправлять одним запросом; больше 1 только с очередью
+	BatchInterval time.Duration // Максимальное время накопления пакета
+}
+
+// webhookSink отправляет события на webhook с подписью и повторами.
+// Без очереди Send доставляет событие сам и возвращает ошибку доставки.
+// С очередью Send только записывает событие на диск, а фоновая горутина
+// отправляет накопленное пакетами; недоставленное остается в очереди до
+// следующей попытки или следующего запуска
+type webhookSink struct {
+	opts    WebhookOptions
+	client  *http.Client
+	headers http.Header
+	queue   *diskQueue // nil, если очередь не задана
+
+	pending atomic.Int64    // Сколько событий записано в очередь с прошлой отправки
+	wake    chan struct{}   // Набрался полный пакет
+	ctx     context.Context // Отменяется, если Close не дождался доставки
+	cancel  context.CancelFunc
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// newWebhookSink проверяет параметры и при заданной очереди запускает фоновую доставку
+func newWebhookSink(opts WebhookOptions) (*webhookSink, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook URL %q", opts.URL)
+	}
+
+	headers := http.Header{}
+	for _, h := range opts.Headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid header %q: expected \"Name: value\"", h)
+		}
+		headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	if opts.BatchSize < 1 {
+		opts.BatchSize = 1
+	}
+	if opts.BatchSize > 1 && opts.QueueDir == "" {
+		return nil, fmt.Errorf("batch-size greater than 1 requires webhook-queue-dir")
+	}
+	if opts.BatchInterval <= 0 {
+		opts.BatchInterval = time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &webhookSink{
+		opts:    opts,
+		client:  &http.Client{Timeout: opts.Timeout},
+		headers: headers,
+		wake:    make(chan struct{}, 1),
+		ctx:     ctx,
+		cancel:  cancel,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if opts.QueueDir == "" {
+		close(w.done)
+		return w, nil
+	}
+
+	if w.queue, err = newDiskQueue(opts.QueueDir); err != nil {
+		cancel()
+		return nil, err
+	}
+	go w.run()
+	return w, nil
+}
+
+func (w *webhookSink) Send(ctx context.Context, event EventInfo) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to serialize event: %w", err)
+	}
+
+	if w.queue == nil {
+		err := w.deliver(ctx, [][]byte{data})
+		var rejected webhookRejectedError
+		if errors.As(err, &rejected) {
+			// Как и в очереди, отвергнутое получателем событие не повторяем и не останавливаемся на нем
+			fmt.Fprintf(os.Stderr, "Warning: webhook rejected %s event: %v\n", event.Type, rejected)
+			return nil
+		}
+		return err
+	}
+
+	// Событие подтверждается только после записи на диск
+	if err := w.queue.Push(data); err != nil {
+		return fmt.Errorf("failed to queue event for webhook: %w", err)
+	}
+	if w.pending.Add(1) >= int64(w.opts.BatchSize) {
+		select {
+		case w.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (w *webhookSink) Close(ctx context.Context) error {
+	if w.queue == nil {
+		w.cancel()
+		return nil
+	}
+	close(w.stop)
+	select {
+	case <-w.done:
+		w.cancel()
+		return nil
+	case <-ctx.Done():
+		// Прерываем повторы: недоставленные события останутся в очереди до следующего запуска
+		w.cancel()
+		<-w.done
+		return fmt.Errorf("webhook delivery interrupted, %d events left in queue: %w", w.queue.Len(), ctx.Err())
+	}
+}
+
+// run отправляет события из очереди, когда набирается пакет или истекает интервал накопления
+func (w *webhookSink) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.opts.BatchInterval)
+	defer ticker.Stop()
+
+	// Сначала отправляем то, что осталось с прошлого запуска
+	var retryAt time.Time
+	flush := func() {
+		if time.Now().Before(retryAt) {
+			return
+		}
+		if err := w.flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: webhook delivery failed, %d events kept in queue: %v\n", w.queue.Len(), err)
+			retryAt = time.Now().Add(webhookQueueRetryInterval)
+			return
+		}
+		retryAt = time.Time{}
+	}
+	flush()
+	for {
+		select {
+		case <-w.stop:
+			// Последняя попытка без ожидания паузы между повторами
+			retryAt = time.Time{}
+			flush()
+			return
+		case <-w.wake:
+			flush()
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// flush отправляет очередь пакетами по порядку и останавливается на первой ошибке
+func (w *webhookSink) flush() error {
+	w.pending.Store(0)
+	return w.queue.DrainBatch(w.opts.BatchSize, func(items [][]byte) error {
+		err := w.deliver(w.ctx, items)
+		var rejected webhookRejectedError
+		if errors.As(err, &rejected) {
+			return errQueueRejected{rejected}
+		}
+		return err
+	})
+}
+
+// deliver отправляет пакет с повторами: одиночное событие — объектом, несколько — массивом
+func (w *webhookSink) deliver(ctx context.Context, items [][]byte) error {
+	body := items[0]
+	if w.opts.BatchSize > 1 {
+		body = append(append([]byte("["), bytes.Join(items, []byte(","))...), ']')
+	}
+
+	start := time.Now()
+	policy := backoff.NewExponentialBackOff()
+	policy.MaxElapsedTime = w.opts.RetryTime
+	err := backoff.Retry(func() error {
+		return w.post(ctx, body)
+	}, backoff.WithContext(policy, ctx))
+	observeSinkDelivery(SinkWebhook, start, err)
+	return err
+}
+
+// post отправляет тело запроса; ошибки 4xx, кроме 408 и 429, повторять бессмысленно
+func (w *webhookSink) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return backoff.Permanent(err)
+	}
+	for name, values := range w.headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Подпись покрывает метку времени, чтобы получатель мог отбросить повторно воспроизведенные запросы
+	if w.opts.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Webhook-Timestamp", timestamp)
+		req.Header.Set("X-Webhook-Signature", "sha256="+signWebhook(w.opts.Secret, timestamp, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return backoff.Permanent(webhookRejectedError{resp.Status})
+}
+
+// webhookRejectedError означает, что получатель отверг запрос и повторять его бессмысленно
+type webhookRejectedError struct {
+	status string
+}
+
+func (e webhookRejectedError) Error() string {
+	return "webhook rejected the request with " + e.status
+}
+
+// signWebhook вычисляет HMAC-SHA256 от "<timestamp>.<body>"
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}